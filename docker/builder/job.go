@@ -1,7 +1,9 @@
 package builder
 
 import (
+	"archive/tar"
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -11,11 +13,14 @@ import (
 	"strings"
 	"sync"
 
+	"github.com/Sirupsen/logrus"
 	"github.com/docker/docker/api"
+	"github.com/docker/docker/builder/next"
 	"github.com/docker/docker/builder/parser"
 	"github.com/docker/docker/cliconfig"
 	"github.com/docker/docker/daemon"
 	"github.com/docker/docker/graph/tags"
+	"github.com/docker/docker/image/oci"
 	"github.com/docker/docker/pkg/archive"
 	"github.com/docker/docker/pkg/httputils"
 	"github.com/docker/docker/pkg/parsers"
@@ -29,6 +34,11 @@ import (
 	"github.com/docker/docker/utils"
 )
 
+// FrontendBuildKit selects the BuildKit-style concurrent backend in
+// Config.Frontend. Any other value (including the empty string) uses the
+// classic linear dispatcher.
+const FrontendBuildKit = "buildkit"
+
 // When downloading remote contexts, limit the amount (in bytes)
 // to be read from the response body in order to detect its Content-Type
 const maxPreambleLength = 100
@@ -67,39 +77,90 @@ type Config struct {
 	Ulimits        []*ulimit.Ulimit
 	AuthConfigs    map[string]cliconfig.AuthConfig
 
+	// Mirrors lists pull-through registry mirror endpoints, tried in order,
+	// ahead of the canonical registry when pulling the FROM image during
+	// Build. It is populated from the per-build request but typically
+	// defaults to the daemon-wide mirrors configured at startup. Mirror
+	// selection only applies to pulls against the official index.
+	Mirrors []string
+
+	// PullImage pulls repoName:tag from a single registry endpoint
+	// ("" meaning the default index) and is how Build obtains base images
+	// it doesn't already have, trying Mirrors (via mirrorPull) ahead of the
+	// canonical endpoint. It is only consulted when Pull is true; leaving
+	// it nil (the default) skips pulling entirely and builds fail on a
+	// missing base image exactly as they did before this field existed.
+	// Only the FrontendBuildKit path uses it directly - the classic
+	// dispatcher has its own, separate pull phase.
+	PullImage pullFunc
+
+	// Frontend selects the build backend. The zero value runs the classic
+	// linear dispatcher; FrontendBuildKit runs the DAG-based solver in
+	// builder/next instead.
+	Frontend string
+
+	// OutputMediaType, when set to oci.MediaTypeManifest, additionally
+	// writes the resulting image as an OCI Image Spec v1 manifest and
+	// reports its digest via a "moby.image.id" aux progress event. The
+	// classic Docker v1 image is always produced regardless of this field.
+	OutputMediaType string
+
+	// ManifestStore, if non-nil, is where the OCI manifest produced by
+	// OutputMediaType is persisted. It is ignored when OutputMediaType is
+	// unset.
+	ManifestStore oci.Store
+
 	Stdout  io.Writer
 	Context io.ReadCloser
-	// When closed, the job has been cancelled.
-	// Note: not all jobs implement cancellation.
-	// See Job.Cancel() and Job.WaitCancelled()
-	cancelled  chan struct{}
+
+	cancel     context.CancelFunc
 	cancelOnce sync.Once
 }
 
-// Cancel signals the build job to cancel
+// Cancel signals the build job to cancel. It is a shim over the
+// context.CancelFunc derived from the ctx passed to Build/BuildFromConfig,
+// kept so existing callers that predate context support still work.
+// Calling Cancel before Build has been called on this Config is a no-op.
 func (b *Config) Cancel() {
-	b.cancelOnce.Do(func() {
-		close(b.cancelled)
-	})
-}
-
-// WaitCancelled returns a channel which is closed ("never blocks") when
-// the job is cancelled.
-func (b *Config) WaitCancelled() <-chan struct{} {
-	return b.cancelled
+	if b.cancel == nil {
+		return
+	}
+	b.cancelOnce.Do(b.cancel)
 }
 
 // NewBuildConfig returns a new Config struct
 func NewBuildConfig() *Config {
 	return &Config{
 		AuthConfigs: map[string]cliconfig.AuthConfig{},
-		cancelled:   make(chan struct{}),
 	}
 }
 
+// instanceIDKey is the context.Value key under which Build stores the
+// per-build instance ID so it can be surfaced in log lines from any
+// function reached transitively from Build.
+type instanceIDKey struct{}
+
+// InstanceID returns the instance ID embedded in ctx by Build, or "" if ctx
+// did not come from a call to Build.
+func InstanceID(ctx context.Context) string {
+	id, _ := ctx.Value(instanceIDKey{}).(string)
+	return id
+}
+
 // Build is the main interface of the package, it gathers the Builder
-// struct and calls builder.Run() to do all the real build job.
-func Build(d *daemon.Daemon, buildConfig *Config) error {
+// struct and calls builder.Run() to do all the real build job. ctx governs
+// the lifetime of the whole build: cancelling it aborts in-flight remote
+// context downloads, git clones, registry pulls, and the dispatch loop.
+func Build(ctx context.Context, d *daemon.Daemon, buildConfig *Config) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	buildConfig.cancel = cancel
+
+	if InstanceID(ctx) == "" {
+		ctx = context.WithValue(ctx, instanceIDKey{}, stringid.GenerateRandomID())
+	}
+	logrus.Debugf("builder: build %s starting for repo %q, frontend=%q", InstanceID(ctx), buildConfig.RepoName, buildConfig.Frontend)
+
 	var (
 		repoName string
 		tag      string
@@ -122,7 +183,7 @@ func Build(d *daemon.Daemon, buildConfig *Config) error {
 	if buildConfig.RemoteURL == "" {
 		context = ioutil.NopCloser(buildConfig.Context)
 	} else if urlutil.IsGitURL(buildConfig.RemoteURL) {
-		root, err := utils.GitClone(buildConfig.RemoteURL)
+		root, err := gitCloneContext(ctx, buildConfig.RemoteURL)
 		if err != nil {
 			return err
 		}
@@ -132,7 +193,7 @@ func Build(d *daemon.Daemon, buildConfig *Config) error {
 		if err != nil {
 			return err
 		}
-		context = c
+		context = cancelOnDone(ctx, c)
 	} else if urlutil.IsURL(buildConfig.RemoteURL) {
 		f, err := httputils.Download(buildConfig.RemoteURL)
 		if err != nil {
@@ -141,7 +202,7 @@ func Build(d *daemon.Daemon, buildConfig *Config) error {
 		defer f.Body.Close()
 		ct := f.Header.Get("Content-Type")
 		clen := f.ContentLength
-		contentType, bodyReader, err := inspectResponse(ct, f.Body, clen)
+		contentType, bodyReader, err := inspectResponse(ctx, ct, f.Body, clen)
 
 		defer bodyReader.Close()
 
@@ -162,7 +223,7 @@ func Build(d *daemon.Daemon, buildConfig *Config) error {
 			if err != nil {
 				return err
 			}
-			context = c
+			context = cancelOnDone(ctx, c)
 		} else {
 			// Pass through - this is a pre-packaged context, presumably
 			// with a Dockerfile with the right name inside it.
@@ -175,12 +236,16 @@ func Build(d *daemon.Daemon, buildConfig *Config) error {
 				ID:        "Downloading context",
 				Action:    buildConfig.RemoteURL,
 			}
-			context = progressreader.New(prCfg)
+			context = cancelOnDone(ctx, progressreader.New(prCfg))
 		}
 	}
 
 	defer context.Close()
 
+	if buildConfig.Frontend == FrontendBuildKit {
+		return buildWithBuildKit(ctx, d, buildConfig, sf, context, repoName, tag)
+	}
+
 	builder := &builder{
 		Daemon: d,
 		OutStream: &streamformatter.StdoutFormatter{
@@ -199,6 +264,7 @@ func Build(d *daemon.Daemon, buildConfig *Config) error {
 		OutOld:          buildConfig.Stdout,
 		StreamFormatter: sf,
 		AuthConfigs:     buildConfig.AuthConfigs,
+		mirrors:         buildConfig.Mirrors,
 		dockerfileName:  buildConfig.DockerfileName,
 		cpuShares:       buildConfig.CPUShares,
 		cpuPeriod:       buildConfig.CPUPeriod,
@@ -209,7 +275,7 @@ func Build(d *daemon.Daemon, buildConfig *Config) error {
 		memory:          buildConfig.Memory,
 		memorySwap:      buildConfig.MemorySwap,
 		ulimits:         buildConfig.Ulimits,
-		cancelled:       buildConfig.WaitCancelled(),
+		ctx:             ctx,
 		id:              stringid.GenerateRandomID(),
 	}
 
@@ -217,8 +283,13 @@ func Build(d *daemon.Daemon, buildConfig *Config) error {
 		builder.Daemon.Graph().Release(builder.id, builder.activeImages...)
 	}()
 
-	id, err := builder.Run(context)
+	id, err := builder.Run(ctx, context)
 	if err != nil {
+		logrus.Errorf("builder: build %s failed: %v", InstanceID(ctx), err)
+		return err
+	}
+	logrus.Debugf("builder: build %s produced image %s", InstanceID(ctx), id)
+	if err := emitOCIManifest(buildConfig.Stdout, sf, buildConfig.OutputMediaType, id, d, buildConfig.ManifestStore); err != nil {
 		return err
 	}
 	if repoName != "" {
@@ -232,7 +303,7 @@ func Build(d *daemon.Daemon, buildConfig *Config) error {
 //
 // - call parse.Parse() to get AST root from Dockerfile entries
 // - do build by calling builder.dispatch() to call all entries' handling routines
-func BuildFromConfig(d *daemon.Daemon, c *runconfig.Config, changes []string) (*runconfig.Config, error) {
+func BuildFromConfig(ctx context.Context, d *daemon.Daemon, c *runconfig.Config, changes []string) (*runconfig.Config, error) {
 	ast, err := parser.Parse(bytes.NewBufferString(strings.Join(changes, "\n")))
 	if err != nil {
 		return nil, err
@@ -251,10 +322,11 @@ func BuildFromConfig(d *daemon.Daemon, c *runconfig.Config, changes []string) (*
 		OutStream:     ioutil.Discard,
 		ErrStream:     ioutil.Discard,
 		disableCommit: true,
+		ctx:           ctx,
 	}
 
 	for i, n := range ast.Children {
-		if err := builder.dispatch(i, n); err != nil {
+		if err := builder.dispatch(ctx, i, n); err != nil {
 			return nil, err
 		}
 	}
@@ -271,6 +343,21 @@ type CommitConfig struct {
 	Comment string
 	Changes []string
 	Config  *runconfig.Config
+
+	// OutputMediaType, when set to oci.MediaTypeManifest, additionally
+	// writes the committed image as an OCI Image Spec v1 manifest. See
+	// Config.OutputMediaType.
+	OutputMediaType string
+
+	// ManifestStore, if non-nil, is where the OCI manifest produced by
+	// OutputMediaType is persisted. It is ignored when OutputMediaType is
+	// unset.
+	ManifestStore oci.Store
+
+	// Stdout, if non-nil, receives the "moby.image.id" aux progress event
+	// OutputMediaType produces. Commit still writes and persists the
+	// manifest when Stdout is nil; only that one progress line is skipped.
+	Stdout io.Writer
 }
 
 // Commit will create a new image from a container's changes
@@ -285,11 +372,17 @@ func Commit(name string, d *daemon.Daemon, c *CommitConfig) (string, error) {
 		return "", fmt.Errorf("Windows does not support commit of a running container")
 	}
 
+	if c.OutputMediaType != "" && c.OutputMediaType != oci.MediaTypeManifest {
+		return "", fmt.Errorf("commit: unsupported output media type %q", c.OutputMediaType)
+	}
+
 	if c.Config == nil {
 		c.Config = &runconfig.Config{}
 	}
 
-	newConfig, err := BuildFromConfig(d, c.Config, c.Changes)
+	// Commit applies metadata-only changes synchronously and isn't part of
+	// a cancellable build, so it doesn't carry a caller-supplied context.
+	newConfig, err := BuildFromConfig(context.Background(), d, c.Config, c.Changes)
 	if err != nil {
 		return "", err
 	}
@@ -312,24 +405,217 @@ func Commit(name string, d *daemon.Daemon, c *CommitConfig) (string, error) {
 		return "", err
 	}
 
+	if c.OutputMediaType == oci.MediaTypeManifest {
+		stdout := c.Stdout
+		if stdout == nil {
+			stdout = ioutil.Discard
+		}
+		sf := streamformatter.NewJSONStreamFormatter()
+		if err := emitOCIManifest(stdout, sf, c.OutputMediaType, img.ID, d, c.ManifestStore); err != nil {
+			return "", err
+		}
+	}
+
 	return img.ID, nil
 }
 
+// buildWithBuildKit dispatches to the builder/next solver instead of the
+// classic linear builder. It is only reached when buildConfig.Frontend ==
+// FrontendBuildKit. Progress is reported through the same
+// streamformatter.StdoutFormatter the classic path uses, so output over the
+// `/build` API is indistinguishable between backends.
+func buildWithBuildKit(ctx context.Context, d *daemon.Daemon, buildConfig *Config, sf *streamformatter.StreamFormatter, context io.ReadCloser, repoName, tag string) error {
+	name := buildConfig.DockerfileName
+	if name == "" {
+		name = api.DefaultDockerfileName
+	}
+
+	decompressed, err := archive.DecompressStream(context)
+	if err != nil {
+		return err
+	}
+	buildContext, err := ioutil.ReadAll(decompressed)
+	if err != nil {
+		return err
+	}
+
+	dockerfile, err := extractFile(bytes.NewReader(buildContext), name)
+	if err != nil {
+		return err
+	}
+
+	if buildConfig.Pull && buildConfig.PullImage != nil {
+		if err := pullSourceImages(dockerfile, buildConfig); err != nil {
+			return err
+		}
+	}
+
+	out := &streamformatter.StdoutFormatter{
+		Writer:          buildConfig.Stdout,
+		StreamFormatter: sf,
+	}
+
+	id, err := next.Build(ctx, d, dockerfile, buildContext, out)
+	if err != nil {
+		logrus.Errorf("builder: buildkit build %s failed: %v", InstanceID(ctx), err)
+		return err
+	}
+	logrus.Debugf("builder: buildkit build %s produced image %s", InstanceID(ctx), id)
+	if err := emitOCIManifest(buildConfig.Stdout, sf, buildConfig.OutputMediaType, id, d, buildConfig.ManifestStore); err != nil {
+		return err
+	}
+	if repoName != "" {
+		return d.Repositories().Tag(repoName, tag, id, true)
+	}
+	return nil
+}
+
+// pullSourceImages parses dockerfile into the same LLB DAG next.Build is
+// about to solve, walks it for every distinct FROM reference, and pulls
+// each one with mirrorPull, trying buildConfig.Mirrors before the
+// canonical index. The DAG is built twice (once here, once inside
+// next.Build) rather than threading it through Build's signature, matching
+// buildWithBuildKit's existing habit of deriving its own view of the
+// Dockerfile ahead of next.Build (it already extracts dockerfile and
+// buildContext itself before calling next.Build). A reference that names
+// its own registry host is pulled without trying the mirrors.
+func pullSourceImages(dockerfile []byte, buildConfig *Config) error {
+	ast, err := parser.Parse(bytes.NewReader(dockerfile))
+	if err != nil {
+		return err
+	}
+	root, err := next.ToLLB(ast)
+	if err != nil {
+		return err
+	}
+
+	for _, ref := range next.SourceImages(root) {
+		repoName, tag := parsers.ParseRepositoryTag(ref)
+		mirrors := buildConfig.Mirrors
+		// A first path component that contains "." or ":", or is
+		// "localhost", is a registry host rather than the official index.
+		if i := strings.Index(repoName, "/"); i >= 0 {
+			if host := repoName[:i]; strings.ContainsAny(host, ".:") || host == "localhost" {
+				mirrors = nil
+			}
+		}
+		if err := mirrorPull(mirrors, "", repoName, tag, buildConfig.AuthConfigs, buildConfig.PullImage); err != nil {
+			return fmt.Errorf("Error pulling base image %s: %v", ref, err)
+		}
+	}
+	return nil
+}
+
+// emitOCIManifest writes img as an OCI Image Spec v1 manifest alongside the
+// classic Docker v1 image when mediaType == oci.MediaTypeManifest, persists
+// its raw bytes to store (when non-nil) so a later push can serve back
+// exactly what was written here, and reports its digest through a
+// "moby.image.id" aux event so HTTP clients can pick it up without polling
+// the graph.
+func emitOCIManifest(stdout io.Writer, sf *streamformatter.StreamFormatter, mediaType, imageID string, d *daemon.Daemon, store oci.Store) error {
+	if mediaType != oci.MediaTypeManifest {
+		return nil
+	}
+	layers, err := imageLayerDescriptors(d, imageID)
+	if err != nil {
+		return err
+	}
+	manifest := oci.NewManifest(
+		oci.Descriptor{MediaType: oci.MediaTypeConfig, Digest: "sha256:" + imageID},
+		layers,
+	)
+	digest, raw, err := oci.Write(manifest)
+	if err != nil {
+		return err
+	}
+	if store != nil {
+		if err := store.PutManifest(imageID, raw); err != nil {
+			return err
+		}
+	}
+	_, err = stdout.Write(sf.FormatStatus("moby.image.id", "%s", digest))
+	return err
+}
+
+// imageLayerDescriptors walks imageID's parent chain and returns one
+// Descriptor per ancestor, ordered from the base image to imageID itself.
+// Classic Docker images don't carry a separate content digest per layer
+// the way the OCI spec's layer blobs do, so - matching the config
+// descriptor's own "sha256:"+imageID convention above - each layer's
+// digest is the owning image's ID rather than a hash of its filesystem
+// diff.
+func imageLayerDescriptors(d *daemon.Daemon, imageID string) ([]oci.Descriptor, error) {
+	var layers []oci.Descriptor
+	for id := imageID; id != ""; {
+		img, err := d.Graph().Get(id)
+		if err != nil {
+			return nil, err
+		}
+		layers = append([]oci.Descriptor{{MediaType: oci.MediaTypeLayer, Digest: "sha256:" + img.ID}}, layers...)
+		id = img.Parent
+	}
+	return layers, nil
+}
+
+// extractFile reads a single named file out of a (possibly compressed) tar
+// context stream.
+func extractFile(context io.Reader, name string) ([]byte, error) {
+	decompressed, err := archive.DecompressStream(context)
+	if err != nil {
+		return nil, err
+	}
+	tr := tar.NewReader(decompressed)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if hdr.Name == name {
+			return ioutil.ReadAll(tr)
+		}
+	}
+	return nil, fmt.Errorf("%s: no such file in build context", name)
+}
+
 // inspectResponse looks into the http response data at r to determine whether its
 // content-type is on the list of acceptable content types for remote build contexts.
 // This function returns:
-//    - a string representation of the detected content-type
-//    - an io.Reader for the response body
-//    - an error value which will be non-nil either when something goes wrong while
-//      reading bytes from r or when the detected content-type is not acceptable.
-func inspectResponse(ct string, r io.ReadCloser, clen int64) (string, io.ReadCloser, error) {
+//   - a string representation of the detected content-type
+//   - an io.Reader for the response body
+//   - an error value which will be non-nil either when something goes wrong while
+//     reading bytes from r or when the detected content-type is not acceptable.
+func inspectResponse(ctx context.Context, ct string, r io.ReadCloser, clen int64) (string, io.ReadCloser, error) {
 	plen := clen
 	if plen <= 0 || plen > maxPreambleLength {
 		plen = maxPreambleLength
 	}
 
+	// The initial preamble read can block indefinitely on a stalled remote
+	// context; race it against ctx so a build cancellation aborts it rather
+	// than leaking the goroutine until the server times out on its own.
+	type readResult struct {
+		n   int
+		err error
+	}
 	preamble := make([]byte, plen, plen)
-	rlen, err := r.Read(preamble)
+	resultCh := make(chan readResult, 1)
+	go func() {
+		n, err := r.Read(preamble)
+		resultCh <- readResult{n, err}
+	}()
+
+	var rlen int
+	var err error
+	select {
+	case res := <-resultCh:
+		rlen, err = res.n, res.err
+	case <-ctx.Done():
+		r.Close()
+		return ct, r, ctx.Err()
+	}
 	if rlen == 0 {
 		return ct, r, errors.New("Empty response")
 	}
@@ -338,7 +624,7 @@ func inspectResponse(ct string, r io.ReadCloser, clen int64) (string, io.ReadClo
 	}
 
 	preambleR := bytes.NewReader(preamble)
-	bodyReader := ioutil.NopCloser(io.MultiReader(preambleR, r))
+	bodyReader := cancelOnDone(ctx, ioutil.NopCloser(io.MultiReader(preambleR, r)))
 	// Some web servers will use application/octet-stream as the default
 	// content type for files without an extension (e.g. 'Dockerfile')
 	// so if we receive this value we better check for text content
@@ -359,3 +645,56 @@ func inspectResponse(ct string, r io.ReadCloser, clen int64) (string, io.ReadClo
 
 	return contentType, bodyReader, cterr
 }
+
+// gitCloneContext clones remoteURL, aborting and cleaning up the partial
+// clone if ctx is cancelled before utils.GitClone returns. utils.GitClone
+// itself has no context support, so cancellation here can only stop us from
+// handing a half-finished checkout back to the caller; the git subprocess
+// is left to exit on its own.
+func gitCloneContext(ctx context.Context, remoteURL string) (string, error) {
+	type cloneResult struct {
+		root string
+		err  error
+	}
+	resultCh := make(chan cloneResult, 1)
+	go func() {
+		root, err := utils.GitClone(remoteURL)
+		resultCh <- cloneResult{root, err}
+	}()
+
+	select {
+	case res := <-resultCh:
+		return res.root, res.err
+	case <-ctx.Done():
+		go func() {
+			if res := <-resultCh; res.root != "" {
+				os.RemoveAll(res.root)
+			}
+		}()
+		return "", ctx.Err()
+	}
+}
+
+// cancelOnDone wraps rc so that cancelling ctx forces any blocked or future
+// Read to unblock with an error, by closing the underlying stream.
+func cancelOnDone(ctx context.Context, rc io.ReadCloser) io.ReadCloser {
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			rc.Close()
+		case <-done:
+		}
+	}()
+	return &cancelReadCloser{ReadCloser: rc, done: done}
+}
+
+type cancelReadCloser struct {
+	io.ReadCloser
+	done chan struct{}
+}
+
+func (c *cancelReadCloser) Close() error {
+	close(c.done)
+	return c.ReadCloser.Close()
+}
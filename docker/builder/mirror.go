@@ -0,0 +1,43 @@
+package builder
+
+import (
+	"fmt"
+
+	"github.com/docker/docker/cliconfig"
+)
+
+// pullFunc pulls repoName:tag from a single registry endpoint. It is
+// implemented in terms of the registry package's existing pull path; it
+// exists as a type here so mirrorPull can be exercised independently of a
+// live registry.
+type pullFunc func(endpoint, repoName, tag string, auth cliconfig.AuthConfig) error
+
+// mirrorPull attempts repoName:tag against each of mirrors in order before
+// falling back to the canonical registry endpoint, using the per-mirror
+// AuthConfig when one is configured in authConfigs. It is only consulted
+// for pulls against the official index; pulls against a different, already
+// pinned registry are unaffected since there is nothing to mirror.
+//
+// Failure on one mirror rolls transparently to the next. If every mirror
+// and the canonical endpoint fail, the returned error leads with the
+// canonical endpoint's error, since that is the error an operator without
+// mirrors configured would have seen, and appends the last mirror's error.
+func mirrorPull(mirrors []string, canonical, repoName, tag string, authConfigs map[string]cliconfig.AuthConfig, pull pullFunc) error {
+	var lastErr error
+	for _, mirror := range mirrors {
+		auth := authConfigs[mirror]
+		if err := pull(mirror, repoName, tag, auth); err == nil {
+			return nil
+		} else {
+			lastErr = err
+		}
+	}
+
+	if err := pull(canonical, repoName, tag, authConfigs[canonical]); err != nil {
+		if lastErr != nil {
+			return fmt.Errorf("%v (mirrors also failed: %v)", err, lastErr)
+		}
+		return err
+	}
+	return nil
+}
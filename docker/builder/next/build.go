@@ -0,0 +1,31 @@
+package next
+
+import (
+	"bytes"
+	"context"
+	"io"
+
+	"github.com/docker/docker/builder/parser"
+	"github.com/docker/docker/daemon"
+)
+
+// Build parses dockerfile and solves it against d, reporting progress to
+// out. buildContext is the (decompressed) tar stream the Dockerfile itself
+// was extracted from, which the executor reads COPY/ADD sources out of. It
+// is the entrypoint the classic builder.Build dispatches to when
+// Config.Frontend == "buildkit". Cancelling ctx aborts the solve before any
+// not-yet-started vertex begins executing.
+func Build(ctx context.Context, d *daemon.Daemon, dockerfile, buildContext []byte, out io.Writer) (string, error) {
+	ast, err := parser.Parse(bytes.NewReader(dockerfile))
+	if err != nil {
+		return "", err
+	}
+
+	root, err := ToLLB(ast)
+	if err != nil {
+		return "", err
+	}
+
+	solver := NewSolver(ctx, NewDaemonExecutor(d, buildContext), NewCacheManager(), out)
+	return solver.Solve(root)
+}
@@ -0,0 +1,40 @@
+package next
+
+import (
+	"strings"
+	"sync"
+)
+
+// CacheManager maps op digests to the image ID produced the last time that
+// op ran against that particular set of parents. This replaces the classic
+// dispatcher's parent-image-chain cache (which only ever compares a command
+// string against the image history) with a cache keyed purely on op
+// content, so independent branches of the DAG can share cached results.
+type CacheManager struct {
+	mu    sync.Mutex
+	cache map[string]string // key: parents + op digest -> image ID
+}
+
+// NewCacheManager returns an empty CacheManager.
+func NewCacheManager() *CacheManager {
+	return &CacheManager{cache: make(map[string]string)}
+}
+
+func cacheKey(parents []string, op Op) string {
+	return strings.Join(parents, "+") + "/" + op.Digest()
+}
+
+// Get returns the cached image ID for op run against parents, if any.
+func (c *CacheManager) Get(parents []string, op Op) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	id, ok := c.cache[cacheKey(parents, op)]
+	return id, ok
+}
+
+// Set records the image ID produced by running op against parents.
+func (c *CacheManager) Set(parents []string, op Op, imageID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cache[cacheKey(parents, op)] = imageID
+}
@@ -0,0 +1,177 @@
+package next
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/docker/docker/builder/parser"
+)
+
+// ToLLB walks the parsed Dockerfile AST and converts it into a DAG of ops.
+// Unlike the classic dispatcher, which threads a single *Config through a
+// linear list of instructions, this produces a real multi-rooted DAG: each
+// FROM starts a new, independent stage with no Inputs of its own, so the
+// solver can build stages that don't depend on each other concurrently.
+// A later stage only gains an edge back to an earlier one when it actually
+// names it via `COPY --from=<stage>`.
+func ToLLB(ast *parser.Node) (*Vertex, error) {
+	var cur *Vertex
+	var stageTails []*Vertex
+	stageNames := map[string]int{}
+	stageIndex := -1
+
+	for _, n := range ast.Children {
+		op, fromStage, err := opFromNode(n)
+		if err != nil {
+			return nil, err
+		}
+		if op == nil {
+			// Instruction has no LLB equivalent (e.g. metadata-only
+			// directives like LABEL); skip it for graph purposes.
+			continue
+		}
+
+		if src, ok := op.(*SourceOp); ok {
+			stageIndex++
+			stageTails = append(stageTails, nil)
+			if alias := stageAlias(n); alias != "" {
+				stageNames[alias] = stageIndex
+			}
+			cur = &Vertex{Op: src, Name: n.Value}
+			stageTails[stageIndex] = cur
+			continue
+		}
+		if stageIndex < 0 {
+			return nil, fmt.Errorf("%s has no preceding FROM", strings.ToUpper(n.Value))
+		}
+
+		v := &Vertex{Op: op, Name: n.Value}
+		if cur != nil {
+			v.Inputs = append(v.Inputs, cur)
+		}
+		if fromStage != "" {
+			idx, ok := resolveStage(fromStage, stageNames, stageIndex)
+			if !ok {
+				return nil, fmt.Errorf("%s --from=%s: unknown or forward stage reference", strings.ToUpper(n.Value), fromStage)
+			}
+			// This is what makes the graph a real DAG rather than a chain:
+			// v now depends on both its own stage's predecessor and the
+			// tail of an earlier, otherwise-unrelated stage, and the
+			// solver solves them concurrently.
+			v.Inputs = append(v.Inputs, stageTails[idx])
+		}
+		cur = v
+		stageTails[stageIndex] = cur
+	}
+	if cur == nil {
+		return nil, fmt.Errorf("Dockerfile yields no buildkit ops")
+	}
+	return cur, nil
+}
+
+// SourceImages returns the image reference of every SourceOp reachable from
+// root, in first-encountered order with duplicates removed. Callers that
+// need to pull base images before the solver runs (the solver itself
+// assumes they are already present locally, see executor.go) walk the DAG
+// with this instead of re-deriving FROM references from the Dockerfile
+// themselves.
+func SourceImages(root *Vertex) []string {
+	var images []string
+	seen := map[string]bool{}
+	var visited map[*Vertex]bool = map[*Vertex]bool{}
+
+	var walk func(v *Vertex)
+	walk = func(v *Vertex) {
+		if v == nil || visited[v] {
+			return
+		}
+		visited[v] = true
+		if src, ok := v.Op.(*SourceOp); ok && !seen[src.Image] {
+			seen[src.Image] = true
+			images = append(images, src.Image)
+		}
+		for _, in := range v.Inputs {
+			walk(in)
+		}
+	}
+	walk(root)
+	return images
+}
+
+// resolveStage looks up a COPY --from reference, which may name an earlier
+// stage either by its `AS name` alias or by its zero-based index. Only
+// stages that appear strictly before the current one are valid, matching
+// the classic dispatcher's multi-stage build semantics.
+func resolveStage(ref string, stageNames map[string]int, currentStage int) (int, bool) {
+	if idx, ok := stageNames[ref]; ok && idx < currentStage {
+		return idx, true
+	}
+	if idx, err := strconv.Atoi(ref); err == nil && idx >= 0 && idx < currentStage {
+		return idx, true
+	}
+	return 0, false
+}
+
+// stageAlias returns the `AS name` alias of a FROM instruction, or "" if it
+// has none.
+func stageAlias(n *parser.Node) string {
+	args := collectArgs(n)
+	for i := 0; i < len(args)-1; i++ {
+		if strings.EqualFold(args[i], "as") {
+			return args[i+1]
+		}
+	}
+	return ""
+}
+
+// opFromNode converts a single Dockerfile instruction into an Op. For a
+// COPY/ADD instruction carrying a --from=<stage> flag, it also returns the
+// referenced stage name/index so the caller can wire up the cross-stage
+// dependency.
+func opFromNode(n *parser.Node) (op Op, fromStage string, err error) {
+	switch strings.ToLower(n.Value) {
+	case "from":
+		if n.Next == nil {
+			return nil, "", fmt.Errorf("FROM requires an image name")
+		}
+		return &SourceOp{Image: n.Next.Value}, "", nil
+	case "run":
+		return &ExecOp{Args: collectArgs(n)}, "", nil
+	case "copy", "add":
+		args := collectArgs(n)
+		var from string
+		var rest []string
+		for _, a := range args {
+			if f, ok := parseFromFlag(a); ok {
+				from = f
+				continue
+			}
+			rest = append(rest, a)
+		}
+		if len(rest) < 2 {
+			return nil, "", fmt.Errorf("%s requires a source and destination", strings.ToUpper(n.Value))
+		}
+		return &CopyOp{Src: rest[0], Dest: rest[len(rest)-1], FromStage: from}, from, nil
+	default:
+		return nil, "", nil
+	}
+}
+
+// parseFromFlag recognizes the `--from=<stage>` flag COPY/ADD accept in a
+// multi-stage build.
+func parseFromFlag(arg string) (string, bool) {
+	const prefix = "--from="
+	if !strings.HasPrefix(arg, prefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(arg, prefix), true
+}
+
+func collectArgs(n *parser.Node) []string {
+	var args []string
+	for p := n.Next; p != nil; p = p.Next {
+		args = append(args, p.Value)
+	}
+	return args
+}
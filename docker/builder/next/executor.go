@@ -0,0 +1,162 @@
+package next
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/docker/docker/daemon"
+	"github.com/docker/docker/runconfig"
+)
+
+// Executor runs a single Op against the filesystems produced by its inputs
+// and returns the resulting image ID. parents is in the same order as the
+// Vertex's Inputs: parents[0] is always the chain predecessor; any further
+// entries are the extra dependencies a multi-input op (e.g. a CopyOp with
+// FromStage set) was given. Executor exists so the solver does not need to
+// know how an op is actually carried out on the daemon's graph driver.
+type Executor interface {
+	Execute(op Op, parents []string) (string, error)
+}
+
+// daemonExecutor is the Executor used in production: it drives op execution
+// through daemon.Daemon.Create, the same entrypoint the classic dispatcher
+// uses to materialize containers. buildContext holds the (decompressed) tar
+// stream backing any COPY/ADD instruction that doesn't use --from.
+type daemonExecutor struct {
+	daemon       *daemon.Daemon
+	buildContext []byte
+}
+
+// NewDaemonExecutor returns an Executor backed by the given daemon, reading
+// plain COPY/ADD sources out of buildContext.
+func NewDaemonExecutor(d *daemon.Daemon, buildContext []byte) Executor {
+	return &daemonExecutor{daemon: d, buildContext: buildContext}
+}
+
+// Execute implements Executor.
+func (e *daemonExecutor) Execute(op Op, parents []string) (string, error) {
+	var parent string
+	if len(parents) > 0 {
+		parent = parents[0]
+	}
+
+	switch o := op.(type) {
+	case *SourceOp:
+		// The base image is expected to already be present locally; when
+		// Config.Pull is set, builder's pullSourceImages pulls it before
+		// the solver runs.
+		return o.Image, nil
+	case *ExecOp:
+		return e.run(parent, o.Args, o.Env)
+	case *CopyOp:
+		return e.copy(parent, o)
+	default:
+		return "", fmt.Errorf("next: no executor for op %T", op)
+	}
+}
+
+func (e *daemonExecutor) run(parent string, args, env []string) (string, error) {
+	cfg := &runconfig.Config{
+		Image: parent,
+		Cmd:   args,
+		Env:   env,
+	}
+	container, _, err := e.daemon.Create(cfg, nil, "")
+	if err != nil {
+		return "", err
+	}
+	defer e.daemon.Rm(container)
+
+	if err := container.Run(); err != nil {
+		return "", err
+	}
+
+	img, err := e.daemon.Commit(container, &daemon.ContainerCommitConfig{
+		Config: cfg,
+	})
+	if err != nil {
+		return "", err
+	}
+	return img.ID, nil
+}
+
+func (e *daemonExecutor) copy(parent string, o *CopyOp) (string, error) {
+	if o.FromStage != "" {
+		// Copying out of another stage's committed image (rather than the
+		// build context) needs a way to read one image's filesystem while
+		// building another; container.CopyInto only copies a host path
+		// into a container, not between two containers. Rather than fake
+		// support for this with a half-working implementation, report it
+		// plainly until the daemon grows that primitive.
+		return "", fmt.Errorf("next: COPY --from=%s is not yet supported by the buildkit executor", o.FromStage)
+	}
+
+	src, err := e.extractContextFile(o.Src)
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(filepath.Dir(src))
+
+	cfg := &runconfig.Config{
+		Image: parent,
+		Cmd:   []string{"true"},
+	}
+	container, _, err := e.daemon.Create(cfg, nil, "")
+	if err != nil {
+		return "", err
+	}
+	defer e.daemon.Rm(container)
+
+	if err := container.CopyInto(src, o.Dest); err != nil {
+		return "", err
+	}
+
+	img, err := e.daemon.Commit(container, &daemon.ContainerCommitConfig{
+		Config: cfg,
+	})
+	if err != nil {
+		return "", err
+	}
+	return img.ID, nil
+}
+
+// extractContextFile reads name out of the build context tar into a
+// temporary file and returns its path. container.CopyInto takes a host
+// path rather than an io.Reader, so the in-memory context has to land on
+// disk before a COPY/ADD can use it.
+func (e *daemonExecutor) extractContextFile(name string) (string, error) {
+	tr := tar.NewReader(bytes.NewReader(e.buildContext))
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		if hdr.Name != name {
+			continue
+		}
+
+		dir, err := ioutil.TempDir("", "docker-buildkit-copy")
+		if err != nil {
+			return "", err
+		}
+		dest := filepath.Join(dir, filepath.Base(name))
+		f, err := os.Create(dest)
+		if err != nil {
+			return "", err
+		}
+		defer f.Close()
+		if _, err := io.Copy(f, tr); err != nil {
+			return "", err
+		}
+		return dest, nil
+	}
+	return "", fmt.Errorf("next: %s: no such file in build context", name)
+}
@@ -0,0 +1,81 @@
+// Package next implements an alternative, BuildKit-style build backend for
+// the classic `builder` package. Instead of walking the Dockerfile as a
+// linear list of commands, it converts it into a DAG of content-addressable
+// ops and solves that graph, running independent vertices concurrently.
+package next
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+)
+
+// Op is a single node in the LLB (low-level build) graph. Every Op is
+// content-addressed via Digest so the solver's cache manager can decide
+// whether a previous result can be reused instead of re-executing it.
+type Op interface {
+	// Digest returns the content-addressable key for this op. It must only
+	// depend on the op's own parameters, never on its position in the graph.
+	Digest() string
+}
+
+// Vertex is a node in the build DAG: an Op plus the vertices it depends on.
+type Vertex struct {
+	Op     Op
+	Inputs []*Vertex
+
+	// Name is a short human-readable label used for progress reporting.
+	Name string
+}
+
+// SourceOp resolves a base image, equivalent to a Dockerfile FROM.
+type SourceOp struct {
+	Image string
+}
+
+// Digest implements Op.
+func (s *SourceOp) Digest() string {
+	return digest("source", s.Image)
+}
+
+// ExecOp runs a command against the filesystem produced by its input,
+// equivalent to a Dockerfile RUN.
+type ExecOp struct {
+	Args []string
+	Env  []string
+}
+
+// Digest implements Op.
+func (e *ExecOp) Digest() string {
+	return digest("exec", fmt.Sprintf("%v", e.Args), fmt.Sprintf("%v", e.Env))
+}
+
+// CopyOp copies files into the filesystem produced by its input, equivalent
+// to a Dockerfile COPY or ADD. If FromStage is empty, Src is read from the
+// build context. Otherwise FromStage names an earlier stage (a
+// `COPY --from=<stage>`), whose tail is an additional Input of the
+// containing Vertex alongside the chain predecessor; the daemon executor
+// returns an error for such an op rather than copying out of that stage.
+type CopyOp struct {
+	Src       string
+	Dest      string
+	FromStage string
+}
+
+// Digest implements Op.
+func (c *CopyOp) Digest() string {
+	return digest("copy", c.Src, c.Dest, c.FromStage)
+}
+
+// digest computes a stable content-addressable key from a set of parts. It
+// is intentionally simple (sha256 of the joined parts) rather than pulling
+// in a full digest/media-type package, since ops here are only ever
+// compared to each other, never exchanged with a registry.
+func digest(parts ...string) string {
+	h := sha256.New()
+	for _, p := range parts {
+		h.Write([]byte(p))
+		h.Write([]byte{0})
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,127 @@
+package next
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Solver walks a DAG of ops and executes each vertex at most once,
+// running vertices whose inputs are already satisfied concurrently.
+// Progress is written to Out, which the caller wires up to the same
+// streamformatter.JSONStreamFormatter the classic dispatcher uses so the
+// `/build` HTTP API remains byte-compatible regardless of which backend
+// produced it.
+type Solver struct {
+	ctx      context.Context
+	Executor Executor
+	Cache    *CacheManager
+	Out      io.Writer
+
+	mu      sync.Mutex
+	results map[*Vertex]*vertexResult
+}
+
+type vertexResult struct {
+	once    sync.Once
+	imageID string
+	err     error
+}
+
+// NewSolver returns a Solver ready to solve one or more DAGs sharing the
+// same cache and executor. Cancelling ctx aborts the solve before any
+// not-yet-started vertex begins executing.
+func NewSolver(ctx context.Context, executor Executor, cache *CacheManager, out io.Writer) *Solver {
+	return &Solver{
+		ctx:      ctx,
+		Executor: executor,
+		Cache:    cache,
+		Out:      out,
+		results:  make(map[*Vertex]*vertexResult),
+	}
+}
+
+// Solve resolves root, executing any not-yet-cached ancestors concurrently,
+// and returns the image ID produced by root.
+func (s *Solver) Solve(root *Vertex) (string, error) {
+	return s.solveVertex(root)
+}
+
+func (s *Solver) solveVertex(v *Vertex) (string, error) {
+	s.mu.Lock()
+	res, ok := s.results[v]
+	if !ok {
+		res = &vertexResult{}
+		s.results[v] = res
+	}
+	s.mu.Unlock()
+
+	res.once.Do(func() {
+		if err := s.ctx.Err(); err != nil {
+			res.err = err
+			return
+		}
+
+		parents, err := s.solveInputs(v)
+		if err != nil {
+			res.err = err
+			return
+		}
+
+		if id, ok := s.Cache.Get(parents, v.Op); ok {
+			fmt.Fprintf(s.Out, "---> Using cache\n")
+			res.imageID = id
+			return
+		}
+
+		fmt.Fprintf(s.Out, "---> Running %s\n", v.Name)
+		id, err := s.Executor.Execute(v.Op, parents)
+		if err != nil {
+			res.err = err
+			return
+		}
+		s.Cache.Set(parents, v.Op, id)
+		res.imageID = id
+	})
+	return res.imageID, res.err
+}
+
+// solveInputs solves every input of v concurrently and returns their image
+// IDs in the same order as v.Inputs, so callers can rely on parents[0]
+// being the chain predecessor and any further entries (e.g. a COPY --from
+// another stage) being identifiable by position. Independent stages and
+// branches are solved in parallel, so an expensive stage referenced by
+// --from doesn't block behind one that is cheap but merely earlier in the
+// Dockerfile.
+func (s *Solver) solveInputs(v *Vertex) ([]string, error) {
+	if len(v.Inputs) == 0 {
+		return nil, nil
+	}
+
+	type result struct {
+		id  string
+		err error
+	}
+	results := make([]result, len(v.Inputs))
+
+	var wg sync.WaitGroup
+	for i, in := range v.Inputs {
+		wg.Add(1)
+		go func(i int, in *Vertex) {
+			defer wg.Done()
+			id, err := s.solveVertex(in)
+			results[i] = result{id: id, err: err}
+		}(i, in)
+	}
+	wg.Wait()
+
+	parents := make([]string, len(results))
+	for i, r := range results {
+		if r.err != nil {
+			return nil, r.err
+		}
+		parents[i] = r.id
+	}
+	return parents, nil
+}
@@ -4,11 +4,15 @@ package fluentd
 
 import (
 	"bytes"
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
+	"io/ioutil"
 	"math"
 	"net"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"text/template"
 
 	"github.com/Sirupsen/logrus"
@@ -20,7 +24,11 @@ type fluentd struct {
 	tag           string
 	containerID   string
 	containerName string
+	extra         map[string]string
 	writer        *fluent.Fluent
+	bufferLimit   int
+	dropped       uint64
+	pendingBytes  int64
 }
 
 type receiver struct {
@@ -29,11 +37,30 @@ type receiver struct {
 	Name   string
 }
 
+// record is the structured payload posted to fluentd. Unlike the flat
+// map[string]string this driver used to send, the container's labels/env
+// (selected via the "labels"/"env" log opts) are kept as their own nested
+// object so a downstream fluentd parser can match on them without
+// string-splitting.
+type record struct {
+	ContainerID   string            `json:"container_id"`
+	ContainerName string            `json:"container_name"`
+	Source        string            `json:"source"`
+	Log           string            `json:"log"`
+	Extra         map[string]string `json:"extra,omitempty"`
+}
+
 const (
 	name             = "fluentd"
 	defaultHostName  = "localhost"
 	defaultPort      = 24224
 	defaultTagPrefix = "docker"
+
+	// defaultBufferLimit matches fluent-logger-golang's own default; beyond
+	// it, Log drops messages instead of blocking the application.
+	defaultBufferLimit = 1024 * 1024
+	defaultRetryWait   = 1000
+	defaultMaxRetries  = math.MaxInt32
 )
 
 func init() {
@@ -88,9 +115,67 @@ func parseConfig(ctx logger.Context) (string, int, string, error) {
 	return host, port, tag, nil
 }
 
-// New creates a fluentd logger using the configuration passed in on
-// the context. Supported context configuration variables are
-// fluentd-address & fluentd-tag.
+func boolOpt(config map[string]string, key string) (bool, error) {
+	v := config[key]
+	if v == "" {
+		return false, nil
+	}
+	return strconv.ParseBool(v)
+}
+
+func intOpt(config map[string]string, key string, def int) (int, error) {
+	v := config[key]
+	if v == "" {
+		return def, nil
+	}
+	return strconv.Atoi(v)
+}
+
+// tlsConfig builds a *tls.Config from the fluentd-tls-* options, or returns
+// nil if fluentd-tls is not set. When set, the underlying fluent.Fluent
+// client dials the endpoint with tls.Dial using this configuration instead
+// of a plain net.Dial.
+func tlsConfig(config map[string]string) (*tls.Config, error) {
+	enabled, err := boolOpt(config, "fluentd-tls")
+	if err != nil || !enabled {
+		return nil, err
+	}
+
+	cfg := &tls.Config{}
+
+	if verify, err := boolOpt(config, "fluentd-tls-verify"); err != nil {
+		return nil, err
+	} else if config["fluentd-tls-verify"] != "" {
+		cfg.InsecureSkipVerify = !verify
+	}
+
+	if ca := config["fluentd-tls-ca-cert"]; ca != "" {
+		pem, err := ioutil.ReadFile(ca)
+		if err != nil {
+			return nil, fmt.Errorf("fluentd: reading %s: %v", ca, err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("fluentd: %s contains no usable certificates", ca)
+		}
+		cfg.RootCAs = pool
+	}
+
+	certFile := config["fluentd-tls-cert"]
+	keyFile := config["fluentd-tls-key"]
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("fluentd: loading client keypair: %v", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return cfg, nil
+}
+
+// New creates a fluentd logger using the configuration passed in on the
+// context. See ValidateLogOpt for the supported fluentd-* options.
 func New(ctx logger.Context) (logger.Logger, error) {
 	host, port, tag, err := parseConfig(ctx)
 	if err != nil {
@@ -98,42 +183,132 @@ func New(ctx logger.Context) (logger.Logger, error) {
 	}
 	logrus.Debugf("logging driver fluentd configured for container:%s, host:%s, port:%d, tag:%s.", ctx.ContainerID, host, port, tag)
 
-	// logger tries to recoonect 2**32 - 1 times
-	// failed (and panic) after 204 years [ 1.5 ** (2**32 - 1) - 1 seconds]
-	log, err := fluent.New(fluent.Config{FluentPort: port, FluentHost: host, RetryWait: 1000, MaxRetry: math.MaxInt32})
+	config := ctx.Config
+
+	tlsCfg, err := tlsConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	async, err := boolOpt(config, "fluentd-async-connect")
 	if err != nil {
 		return nil, err
 	}
+
+	bufferLimit, err := intOpt(config, "fluentd-buffer-limit", defaultBufferLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	retryWait, err := intOpt(config, "fluentd-retry-wait", defaultRetryWait)
+	if err != nil {
+		return nil, err
+	}
+
+	maxRetries, err := intOpt(config, "fluentd-max-retries", defaultMaxRetries)
+	if err != nil {
+		return nil, err
+	}
+
+	subSecond, err := boolOpt(config, "fluentd-sub-second-precision")
+	if err != nil {
+		return nil, err
+	}
+
+	log, err := fluent.New(fluent.Config{
+		FluentPort:         port,
+		FluentHost:         host,
+		TLSConfig:          tlsCfg,
+		Async:              async,
+		BufferLimit:        bufferLimit,
+		RetryWait:          retryWait,
+		MaxRetry:           maxRetries,
+		SubSecondPrecision: subSecond,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	extra, err := ctx.ExtraAttributes(nil)
+	if err != nil {
+		return nil, err
+	}
+
 	return &fluentd{
 		tag:           tag,
 		containerID:   ctx.ContainerID,
 		containerName: ctx.ContainerName,
+		extra:         extra,
 		writer:        log,
+		bufferLimit:   bufferLimit,
 	}, nil
 }
 
 func (f *fluentd) Log(msg *logger.Message) error {
-	data := map[string]string{
-		"container_id":   f.containerID,
-		"container_name": f.containerName,
-		"source":         msg.Source,
-		"log":            string(msg.Line),
-	}
-	// fluent-logger-golang buffers logs from failures and disconnections,
-	// and these are transferred again automatically.
-	return f.writer.PostWithTime(f.tag, msg.Timestamp, data)
+	r := &record{
+		ContainerID:   f.containerID,
+		ContainerName: f.containerName,
+		Source:        msg.Source,
+		Log:           string(msg.Line),
+	}
+	if len(f.extra) > 0 {
+		r.Extra = f.extra
+	}
+
+	// pendingBytes counts every message this driver has handed to the
+	// writer and not yet gotten a PostWithTime result for, and a message
+	// that would push it past bufferLimit is dropped. Whatever
+	// fluent-logger-golang keeps buffered internally after PostWithTime
+	// returns (from failures and disconnections) is not counted, since it
+	// exposes no way to ask how much it is holding.
+	size := int64(len(msg.Line))
+	if f.bufferLimit > 0 && atomic.AddInt64(&f.pendingBytes, size) > int64(f.bufferLimit) {
+		atomic.AddInt64(&f.pendingBytes, -size)
+		dropped := atomic.AddUint64(&f.dropped, 1)
+		logrus.Warnf("fluentd: dropping log line for %s, %d byte buffer limit reached (%d dropped so far)", f.containerID, f.bufferLimit, dropped)
+		return nil
+	}
+	defer atomic.AddInt64(&f.pendingBytes, -size)
+
+	return f.writer.PostWithTime(f.tag, msg.Timestamp, r)
 }
 
-// ValidateLogOpt looks for fluentd specific log options fluentd-address & fluentd-tag.
+// ValidateLogOpt looks for fluentd specific log options.
 func ValidateLogOpt(cfg map[string]string) error {
 	for key := range cfg {
 		switch key {
 		case "fluentd-address":
 		case "fluentd-tag":
+		case "fluentd-tls":
+		case "fluentd-tls-ca-cert":
+		case "fluentd-tls-cert":
+		case "fluentd-tls-key":
+		case "fluentd-tls-verify":
+		case "fluentd-async-connect":
+		case "fluentd-buffer-limit":
+		case "fluentd-retry-wait":
+		case "fluentd-max-retries":
+		case "fluentd-sub-second-precision":
+		case "labels":
+		case "env":
 		default:
 			return fmt.Errorf("unknown log opt '%s' for fluentd log driver", key)
 		}
 	}
+
+	if _, err := tlsConfig(cfg); err != nil {
+		return err
+	}
+	for _, key := range []string{"fluentd-buffer-limit", "fluentd-retry-wait", "fluentd-max-retries"} {
+		if _, err := intOpt(cfg, key, 0); err != nil {
+			return fmt.Errorf("fluentd: invalid %s: %v", key, err)
+		}
+	}
+	for _, key := range []string{"fluentd-tls", "fluentd-tls-verify", "fluentd-async-connect", "fluentd-sub-second-precision"} {
+		if _, err := boolOpt(cfg, key); err != nil {
+			return fmt.Errorf("fluentd: invalid %s: %v", key, err)
+		}
+	}
 	return nil
 }
 
@@ -0,0 +1,153 @@
+// Package cni lets libnetwork drivers delegate network interface setup to
+// external plugins conforming to the containernetworking CNI spec, instead
+// of programming interfaces directly via netlink.
+package cni
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// DefaultSearchPath is consulted when a NetConf does not set PluginDir.
+var DefaultSearchPath = []string{"/opt/cni/bin", "/usr/libexec/cni"}
+
+// NetConf is the subset of the CNI network configuration object that
+// AttachCNI/DetachCNI need to locate and invoke a plugin binary. Extra
+// plugin-specific fields are round-tripped through Raw so they reach the
+// plugin on stdin unmodified.
+type NetConf struct {
+	CNIVersion string            `json:"cniVersion"`
+	Name       string            `json:"name"`
+	Type       string            `json:"type"`
+	IPAM       map[string]string `json:"ipam,omitempty"`
+
+	// PluginDir overrides DefaultSearchPath for this invocation.
+	PluginDir []string `json:"-"`
+
+	// Raw is the full configuration document, including fields this
+	// package doesn't model, sent to the plugin verbatim on stdin.
+	Raw json.RawMessage `json:"-"`
+}
+
+// PluginError wraps a non-zero CNI plugin exit with its captured stderr so
+// callers can surface the plugin's own diagnostics rather than just "exit
+// status 1".
+type PluginError struct {
+	Plugin string
+	Err    error
+	Stderr string
+}
+
+func (e *PluginError) Error() string {
+	if e.Stderr == "" {
+		return fmt.Sprintf("cni: plugin %s failed: %v", e.Plugin, e.Err)
+	}
+	return fmt.Sprintf("cni: plugin %s failed: %v: %s", e.Plugin, e.Err, e.Stderr)
+}
+
+// AttachCNI invokes the plugin named by conf.Type with CNI_COMMAND=ADD,
+// wiring netns and the container's interface into it, and returns the
+// plugin's reported result.
+func AttachCNI(netns string, conf *NetConf, args map[string]string) (*Result, error) {
+	out, err := run("ADD", netns, conf, args)
+	if err != nil {
+		return nil, err
+	}
+	return parseResult(conf.CNIVersion, out)
+}
+
+// DetachCNI invokes the plugin named by conf.Type with CNI_COMMAND=DEL,
+// undoing what the matching AttachCNI call set up.
+func DetachCNI(netns string, conf *NetConf, args map[string]string) error {
+	_, err := run("DEL", netns, conf, args)
+	return err
+}
+
+func run(command, netns string, conf *NetConf, args map[string]string) ([]byte, error) {
+	path, err := findPlugin(conf.Type, conf.PluginDir)
+	if err != nil {
+		return nil, err
+	}
+
+	stdin := conf.Raw
+	if len(stdin) == 0 {
+		stdin, err = json.Marshal(conf)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	cmd := exec.Command(path)
+	cmd.Env = []string{
+		"CNI_COMMAND=" + command,
+		"CNI_CONTAINERID=" + args["CNI_CONTAINERID"],
+		"CNI_NETNS=" + netns,
+		"CNI_IFNAME=" + ifNameOrDefault(args["CNI_IFNAME"]),
+		"CNI_ARGS=" + encodeArgs(args),
+		"CNI_PATH=" + searchPath(conf.PluginDir),
+	}
+	cmd.Stdin = bytes.NewReader(stdin)
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return nil, &PluginError{Plugin: conf.Type, Err: err, Stderr: stderr.String()}
+	}
+	return stdout.Bytes(), nil
+}
+
+func ifNameOrDefault(name string) string {
+	if name == "" {
+		return "eth0"
+	}
+	return name
+}
+
+func encodeArgs(args map[string]string) string {
+	var b bytes.Buffer
+	first := true
+	for k, v := range args {
+		if k == "CNI_CONTAINERID" || k == "CNI_IFNAME" {
+			continue
+		}
+		if !first {
+			b.WriteByte(';')
+		}
+		fmt.Fprintf(&b, "%s=%s", k, v)
+		first = false
+	}
+	return b.String()
+}
+
+func searchPath(dirs []string) string {
+	if len(dirs) == 0 {
+		dirs = DefaultSearchPath
+	}
+	path := ""
+	for i, d := range dirs {
+		if i > 0 {
+			path += string(os.PathListSeparator)
+		}
+		path += d
+	}
+	return path
+}
+
+func findPlugin(pluginType string, dirs []string) (string, error) {
+	if len(dirs) == 0 {
+		dirs = DefaultSearchPath
+	}
+	for _, dir := range dirs {
+		p := filepath.Join(dir, pluginType)
+		if fi, err := os.Stat(p); err == nil && !fi.IsDir() {
+			return p, nil
+		}
+	}
+	return "", fmt.Errorf("cni: plugin %q not found in %v", pluginType, dirs)
+}
@@ -0,0 +1,141 @@
+package cni
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+
+	"github.com/docker/libnetwork/netutils"
+)
+
+// Result is the plugin result normalized across CNI spec versions, in terms
+// libnetwork drivers can consume directly.
+type Result struct {
+	IPs    []IPConfig
+	Routes []*net.IPNet
+	DNS    DNS
+}
+
+// IPConfig is one assigned address, with its gateway if the plugin reported
+// one.
+type IPConfig struct {
+	Address net.IPNet
+	Gateway net.IP
+}
+
+// DNS mirrors the CNI "dns" result object.
+type DNS struct {
+	Nameservers []string
+	Domain      string
+	Search      []string
+	Options     []string
+}
+
+// cniVersion04 and cniVersion10 bound the two result layouts this package
+// understands; anything at or above cniVersion10 is parsed with the newer,
+// flattened schema.
+const (
+	cniVersion04 = "0.4.0"
+	cniVersion10 = "1.0.0"
+)
+
+// parseResult decodes a plugin's stdout according to the result schema used
+// by cniVersion, negotiating between the pre-1.0 per-family layout and the
+// 1.0.0+ flattened layout.
+func parseResult(cniVersion string, raw []byte) (*Result, error) {
+	if cniVersion == "" || cniVersion < cniVersion10 {
+		return parseResultLegacy(raw)
+	}
+	return parseResult10(raw)
+}
+
+// parseResultLegacy parses the 0.4.0-style result, which reports IPv4/IPv6
+// under separate "ip4"/"ip6" keys.
+func parseResultLegacy(raw []byte) (*Result, error) {
+	var r struct {
+		IP4 *legacyIPConfig `json:"ip4"`
+		IP6 *legacyIPConfig `json:"ip6"`
+		DNS DNS             `json:"dns"`
+	}
+	if err := json.Unmarshal(raw, &r); err != nil {
+		return nil, fmt.Errorf("cni: parsing %s result: %v", cniVersion04, err)
+	}
+
+	result := &Result{DNS: r.DNS}
+	for _, l := range []*legacyIPConfig{r.IP4, r.IP6} {
+		if l == nil {
+			continue
+		}
+		ip, ipnet, err := net.ParseCIDR(l.IP)
+		if err != nil {
+			return nil, err
+		}
+		ipnet.IP = ip
+		result.IPs = append(result.IPs, IPConfig{Address: *ipnet, Gateway: net.ParseIP(l.Gateway)})
+		for _, rt := range l.Routes {
+			_, dst, err := net.ParseCIDR(rt.Dst)
+			if err != nil {
+				return nil, err
+			}
+			result.Routes = append(result.Routes, dst)
+		}
+	}
+	return result, nil
+}
+
+type legacyIPConfig struct {
+	IP      string `json:"ip"`
+	Gateway string `json:"gateway"`
+	Routes  []struct {
+		Dst string `json:"dst"`
+	} `json:"routes"`
+}
+
+// parseResult10 parses the 1.0.0-style result, which reports a single flat
+// "ips"/"routes" list shared by both address families.
+func parseResult10(raw []byte) (*Result, error) {
+	var r struct {
+		IPs []struct {
+			Address string `json:"address"`
+			Gateway string `json:"gateway"`
+		} `json:"ips"`
+		Routes []struct {
+			Dst string `json:"dst"`
+		} `json:"routes"`
+		DNS DNS `json:"dns"`
+	}
+	if err := json.Unmarshal(raw, &r); err != nil {
+		return nil, fmt.Errorf("cni: parsing %s result: %v", cniVersion10, err)
+	}
+
+	result := &Result{DNS: r.DNS}
+	for _, ip := range r.IPs {
+		addr, ipnet, err := net.ParseCIDR(ip.Address)
+		if err != nil {
+			return nil, err
+		}
+		ipnet.IP = addr
+		result.IPs = append(result.IPs, IPConfig{Address: *ipnet, Gateway: net.ParseIP(ip.Gateway)})
+	}
+	for _, rt := range r.Routes {
+		_, dst, err := net.ParseCIDR(rt.Dst)
+		if err != nil {
+			return nil, err
+		}
+		result.Routes = append(result.Routes, dst)
+	}
+	return result, nil
+}
+
+// FallbackIPAM is used when a plugin's result carries no addresses at all
+// (some bridge-only plugins expect the caller to assign one). It reuses the
+// same interface-naming and MAC-derivation helpers the non-CNI netutils
+// path uses, so CNI-managed and natively-managed interfaces stay
+// consistent within a single daemon.
+func FallbackIPAM(ip net.IP) (ifaceName string, mac net.HardwareAddr, err error) {
+	ifaceName, err = netutils.GenerateIfaceName("cni", 7)
+	if err != nil {
+		return "", nil, err
+	}
+	return ifaceName, netutils.GenerateMACFromIP(ip), nil
+}
@@ -0,0 +1,62 @@
+package cluster
+
+import (
+	"fmt"
+	"io"
+	"net"
+)
+
+// codecNone and codecSnappy are the single-byte capability codes
+// exchanged by negotiateCompression. They deliberately mirror the
+// internal.WriteShardRequest_Compression/internal.MapShardResponse_Compression
+// enum values so a byte read off the wire can be cast straight to
+// Compression.
+const (
+	codecNone   byte = 0
+	codecSnappy byte = 1
+)
+
+// negotiateCompression exchanges one capability byte in each direction
+// over rw, immediately after the TCP mux has routed the connection to the
+// cluster service, and returns the codec both ends agreed to use. Each
+// side writes its own preferred codec, then reads the peer's; the weaker
+// of the two wins, so a node in the middle of a rolling upgrade that
+// doesn't understand CompressionSnappy yet still gets a frame it can
+// read. An older node that doesn't participate in this handshake at all
+// simply never reads the byte this node wrote: the caller is expected to
+// have put a deadline on rw (if it supports one) before calling this, so
+// that case surfaces here as a net.Error with Timeout() true, which is
+// treated the same as an explicit CompressionNone from the peer rather
+// than propagated as an error.
+func negotiateCompression(rw io.ReadWriter, preferred Compression) (Compression, error) {
+	var want byte
+	if preferred == CompressionSnappy {
+		want = codecSnappy
+	}
+
+	if _, err := rw.Write([]byte{want}); err != nil {
+		if ne, ok := err.(net.Error); ok && ne.Timeout() {
+			return CompressionNone, nil
+		}
+		return CompressionNone, err
+	}
+
+	var peer [1]byte
+	if _, err := io.ReadFull(rw, peer[:]); err != nil {
+		if ne, ok := err.(net.Error); ok && ne.Timeout() {
+			return CompressionNone, nil
+		}
+		return CompressionNone, err
+	}
+
+	switch peer[0] {
+	case codecNone, codecSnappy:
+	default:
+		return CompressionNone, fmt.Errorf("cluster: unknown compression capability byte %d", peer[0])
+	}
+
+	if want == codecSnappy && peer[0] == codecSnappy {
+		return CompressionSnappy, nil
+	}
+	return CompressionNone, nil
+}
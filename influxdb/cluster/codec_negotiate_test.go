@@ -0,0 +1,117 @@
+package cluster
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+// pipe is a minimal io.ReadWriter backed by two buffered channels, one per
+// direction. Writes don't block and reads wait for the peer's byte, so both
+// sides of negotiateCompression can write first and then read, which would
+// deadlock on a synchronous net.Pipe.
+type pipe struct {
+	r <-chan byte
+	w chan<- byte
+}
+
+func (p *pipe) Read(b []byte) (int, error) {
+	if len(b) == 0 {
+		return 0, nil
+	}
+	b[0] = <-p.r
+	return 1, nil
+}
+
+func (p *pipe) Write(b []byte) (int, error) {
+	for _, c := range b {
+		p.w <- c
+	}
+	return len(b), nil
+}
+
+func (p *pipe) Close() error { return nil }
+
+func newPipePair() (a, b *pipe) {
+	ch1, ch2 := make(chan byte, 16), make(chan byte, 16)
+	return &pipe{r: ch1, w: ch2}, &pipe{r: ch2, w: ch1}
+}
+
+// negotiatePair runs negotiateCompression on both ends of a pipe pair
+// concurrently, since each end's read waits for the other end's write.
+func negotiatePair(prefA, prefB Compression) (gotA, gotB Compression, errA, errB error) {
+	a, b := newPipePair()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		gotA, errA = negotiateCompression(a, prefA)
+	}()
+	gotB, errB = negotiateCompression(b, prefB)
+	<-done
+	return gotA, gotB, errA, errB
+}
+
+func TestNegotiateCompressionBothWant(t *testing.T) {
+	gotA, gotB, errA, errB := negotiatePair(CompressionSnappy, CompressionSnappy)
+	if errA != nil || errB != nil {
+		t.Fatalf("negotiateCompression errors: %v, %v", errA, errB)
+	}
+	if gotA != CompressionSnappy || gotB != CompressionSnappy {
+		t.Errorf("got (%v, %v), want both CompressionSnappy", gotA, gotB)
+	}
+}
+
+func TestNegotiateCompressionOneDoesNotWant(t *testing.T) {
+	gotA, gotB, errA, errB := negotiatePair(CompressionSnappy, CompressionNone)
+	if errA != nil || errB != nil {
+		t.Fatalf("negotiateCompression errors: %v, %v", errA, errB)
+	}
+	if gotA != CompressionNone || gotB != CompressionNone {
+		t.Errorf("got (%v, %v), want both CompressionNone", gotA, gotB)
+	}
+}
+
+// TestNegotiateCompressionTimesOutToNone exercises an older peer that
+// never participates in the handshake at all: it never reads the byte we
+// write and never writes one of its own. With a deadline set on our side
+// of the connection (as NetShardWriter.WriteShard does), negotiateCompression
+// must fall back to CompressionNone instead of blocking forever or
+// returning an error.
+func TestNegotiateCompressionTimesOutToNone(t *testing.T) {
+	conn, peer := net.Pipe()
+	defer conn.Close()
+	defer peer.Close()
+
+	conn.SetDeadline(time.Now().Add(50 * time.Millisecond))
+
+	got, err := negotiateCompression(conn, CompressionSnappy)
+	if err != nil {
+		t.Fatalf("negotiateCompression: %v", err)
+	}
+	if got != CompressionNone {
+		t.Errorf("got %v, want CompressionNone", got)
+	}
+}
+
+func TestWriteShardRequestMarshalBinaryCompressedRoundTrip(t *testing.T) {
+	req := &WriteShardRequest{}
+	req.SetShardID(42)
+	req.AddPoints(benchPoints(100))
+	req.SetCompression(CompressionSnappy)
+
+	b, err := req.MarshalBinaryCompressed()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := &WriteShardRequest{}
+	if err := got.UnmarshalBinaryCompressed(b); err != nil {
+		t.Fatal(err)
+	}
+	if got.ShardID() != 42 {
+		t.Errorf("ShardID() = %d, want 42", got.ShardID())
+	}
+	if len(got.Points()) != 100 {
+		t.Errorf("len(Points()) = %d, want 100", len(got.Points()))
+	}
+}
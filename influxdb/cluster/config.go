@@ -0,0 +1,26 @@
+package cluster
+
+// Config holds the configuration for the cluster service.
+type Config struct {
+	// Compression is the codec to prefer when writing shard data to other
+	// nodes: "snappy" or "none". negotiateCompression settles on the weaker
+	// of the two ends' preferences, so "none" on either end keeps that
+	// connection uncompressed in both directions.
+	Compression string `toml:"compression"`
+}
+
+// NewConfig returns a Config with the default settings.
+func NewConfig() Config {
+	return Config{
+		Compression: "snappy",
+	}
+}
+
+// compression parses the Compression option into the wire enum, falling
+// back to CompressionNone for anything it doesn't recognize.
+func (c Config) compression() Compression {
+	if c.Compression == "snappy" {
+		return CompressionSnappy
+	}
+	return CompressionNone
+}
@@ -0,0 +1,113 @@
+package cluster
+
+import (
+	"github.com/gogo/protobuf/proto"
+	"github.com/influxdb/influxdb/cluster/internal"
+)
+
+// EvacuateShardRequest represents a request to move all of a shard's data
+// off the local node and onto DestinationNodeIDs, ahead of decommissioning
+// the local node.
+type EvacuateShardRequest struct {
+	pb internal.EvacuateShardRequest
+}
+
+func (e *EvacuateShardRequest) ShardID() uint64              { return e.pb.GetShardID() }
+func (e *EvacuateShardRequest) DestinationNodeIDs() []uint64 { return e.pb.GetDestinationNodeIDs() }
+func (e *EvacuateShardRequest) IgnoreErrors() bool           { return e.pb.GetIgnoreErrors() }
+func (e *EvacuateShardRequest) BatchSize() int32             { return e.pb.GetBatchSize() }
+
+// Database and RetentionPolicy identify which database/retention policy the
+// evacuated points belong to, so ShardWriter.WriteShard can forward them to
+// a destination node that resolves shards by (Database, RetentionPolicy,
+// ShardID) rather than ShardID alone.
+func (e *EvacuateShardRequest) Database() string        { return e.pb.GetDatabase() }
+func (e *EvacuateShardRequest) RetentionPolicy() string { return e.pb.GetRetentionPolicy() }
+
+func (e *EvacuateShardRequest) SetShardID(id uint64) { e.pb.ShardID = &id }
+func (e *EvacuateShardRequest) SetDestinationNodeIDs(ids []uint64) {
+	e.pb.DestinationNodeIDs = ids
+}
+func (e *EvacuateShardRequest) SetDatabase(db string)        { e.pb.Database = &db }
+func (e *EvacuateShardRequest) SetRetentionPolicy(rp string) { e.pb.RetentionPolicy = &rp }
+
+// SetIgnoreErrors controls whether a batch that fails to replicate to a
+// destination is counted as skipped (true) or aborts the whole drain
+// (false, the default). An error reading the local shard always aborts the
+// drain; unreadable points are not skipped.
+func (e *EvacuateShardRequest) SetIgnoreErrors(ignore bool) { e.pb.IgnoreErrors = &ignore }
+
+// SetBatchSize bounds how many points are read from the local shard and
+// forwarded to the destinations per replication round-trip.
+func (e *EvacuateShardRequest) SetBatchSize(n int32) { e.pb.BatchSize = &n }
+
+// MarshalBinary encodes the object to a binary format.
+func (e *EvacuateShardRequest) MarshalBinary() ([]byte, error) {
+	return proto.Marshal(&e.pb)
+}
+
+// UnmarshalBinary populates EvacuateShardRequest from a binary format.
+func (e *EvacuateShardRequest) UnmarshalBinary(buf []byte) error {
+	return proto.Unmarshal(buf, &e.pb)
+}
+
+// EvacuateShardResponse represents the final result of an EvacuateShardRequest.
+type EvacuateShardResponse struct {
+	pb internal.EvacuateShardResponse
+}
+
+func NewEvacuateShardResponse(code int, message string) *EvacuateShardResponse {
+	r := &EvacuateShardResponse{}
+	r.SetCode(code)
+	r.SetMessage(message)
+	return r
+}
+
+func (e *EvacuateShardResponse) Code() int              { return int(e.pb.GetCode()) }
+func (e *EvacuateShardResponse) Message() string        { return e.pb.GetMessage() }
+func (e *EvacuateShardResponse) ObjectsMoved() uint64   { return e.pb.GetObjectsMoved() }
+func (e *EvacuateShardResponse) ObjectsSkipped() uint64 { return e.pb.GetObjectsSkipped() }
+func (e *EvacuateShardResponse) Errors() []string       { return e.pb.GetErrors() }
+
+func (e *EvacuateShardResponse) SetCode(code int)           { e.pb.Code = proto.Int32(int32(code)) }
+func (e *EvacuateShardResponse) SetMessage(message string)  { e.pb.Message = &message }
+func (e *EvacuateShardResponse) SetObjectsMoved(n uint64)   { e.pb.ObjectsMoved = &n }
+func (e *EvacuateShardResponse) SetObjectsSkipped(n uint64) { e.pb.ObjectsSkipped = &n }
+func (e *EvacuateShardResponse) AddError(reason string)     { e.pb.Errors = append(e.pb.Errors, reason) }
+
+// MarshalBinary encodes the object to a binary format.
+func (e *EvacuateShardResponse) MarshalBinary() ([]byte, error) {
+	return proto.Marshal(&e.pb)
+}
+
+// UnmarshalBinary populates EvacuateShardResponse from a binary format.
+func (e *EvacuateShardResponse) UnmarshalBinary(buf []byte) error {
+	return proto.Unmarshal(buf, &e.pb)
+}
+
+// EvacuateShardProgress reports a point-in-time snapshot of an in-flight
+// evacuation, written periodically ahead of the final EvacuateShardResponse
+// so a CLI can render a progress bar.
+type EvacuateShardProgress struct {
+	pb internal.EvacuateShardProgress
+}
+
+func NewEvacuateShardProgress(moved, remaining uint64) *EvacuateShardProgress {
+	p := &EvacuateShardProgress{}
+	p.pb.Moved = &moved
+	p.pb.Remaining = &remaining
+	return p
+}
+
+func (p *EvacuateShardProgress) Moved() uint64     { return p.pb.GetMoved() }
+func (p *EvacuateShardProgress) Remaining() uint64 { return p.pb.GetRemaining() }
+
+// MarshalBinary encodes the object to a binary format.
+func (p *EvacuateShardProgress) MarshalBinary() ([]byte, error) {
+	return proto.Marshal(&p.pb)
+}
+
+// UnmarshalBinary populates EvacuateShardProgress from a binary format.
+func (p *EvacuateShardProgress) UnmarshalBinary(buf []byte) error {
+	return proto.Unmarshal(buf, &p.pb)
+}
@@ -0,0 +1,111 @@
+package cluster
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// evacuateFrameProgress and evacuateFrameResponse distinguish the two
+// frame kinds written to an evacuation stream: zero or more progress
+// updates followed by exactly one final response.
+const (
+	evacuateFrameProgress byte = 0
+	evacuateFrameResponse byte = 1
+)
+
+// writeEvacuateProgress writes a single EvacuateShardProgress frame to w.
+// An evacuation stream carries zero or more of these ahead of the final
+// writeEvacuateResponse frame, for a client reading it with
+// EvacuateShardStream to render progress.
+func writeEvacuateProgress(w io.Writer, p *EvacuateShardProgress) error {
+	b, err := p.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	return writeEvacuateFrame(w, evacuateFrameProgress, b)
+}
+
+// writeEvacuateResponse writes the final EvacuateShardResponse frame to w,
+// terminating the stream.
+func writeEvacuateResponse(w io.Writer, r *EvacuateShardResponse) error {
+	b, err := r.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	return writeEvacuateFrame(w, evacuateFrameResponse, b)
+}
+
+func writeEvacuateFrame(w io.Writer, kind byte, b []byte) error {
+	if len(b) > MaxMessageSize {
+		return fmt.Errorf("cluster: evacuate frame of %d bytes exceeds MaxMessageSize (%d)", len(b), MaxMessageSize)
+	}
+	if _, err := w.Write([]byte{kind}); err != nil {
+		return err
+	}
+	var lenBuf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(lenBuf[:], uint64(len(b)))
+	if _, err := w.Write(lenBuf[:n]); err != nil {
+		return err
+	}
+	_, err := w.Write(b)
+	return err
+}
+
+// EvacuateShardStream presents a server's progress/response frames as an
+// iterator, hiding the frame-kind byte from callers.
+type EvacuateShardStream struct {
+	r    io.Reader
+	done bool
+}
+
+// NewEvacuateShardStream wraps r, which must carry frames written by
+// writeEvacuateProgress/writeEvacuateResponse.
+func NewEvacuateShardStream(r io.Reader) *EvacuateShardStream {
+	return &EvacuateShardStream{r: r}
+}
+
+// Next returns the next progress update, or the final *EvacuateShardResponse
+// once the stream's response frame has been read (after which, done is
+// true and the stream must not be read again).
+func (s *EvacuateShardStream) Next() (progress *EvacuateShardProgress, result *EvacuateShardResponse, err error) {
+	if s.done {
+		return nil, nil, io.EOF
+	}
+
+	kind, err := byteReader{s.r}.ReadByte()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	size, err := binary.ReadUvarint(byteReader{s.r})
+	if err != nil {
+		return nil, nil, err
+	}
+	if size > MaxMessageSize {
+		return nil, nil, fmt.Errorf("cluster: evacuate frame of %d bytes exceeds MaxMessageSize (%d)", size, MaxMessageSize)
+	}
+
+	buf := make([]byte, size)
+	if _, err := io.ReadFull(s.r, buf); err != nil {
+		return nil, nil, err
+	}
+
+	switch kind {
+	case evacuateFrameProgress:
+		p := &EvacuateShardProgress{}
+		if err := p.UnmarshalBinary(buf); err != nil {
+			return nil, nil, err
+		}
+		return p, nil, nil
+	case evacuateFrameResponse:
+		s.done = true
+		r := &EvacuateShardResponse{}
+		if err := r.UnmarshalBinary(buf); err != nil {
+			return nil, nil, err
+		}
+		return nil, r, nil
+	default:
+		return nil, nil, fmt.Errorf("cluster: unknown evacuate frame kind %d", kind)
+	}
+}
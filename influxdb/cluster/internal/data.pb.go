@@ -0,0 +1,896 @@
+// Code generated by protoc-gen-gogo.
+// source: internal/data.proto
+// DO NOT EDIT!
+
+/*
+Package internal is a generated protocol buffer package.
+
+It is generated from these files:
+
+	internal/data.proto
+
+It has these top-level messages:
+
+	Point
+	Field
+	Tag
+	MapShardRequest
+	MapShardResponse
+	WriteShardRequest
+	PointError
+	WriteShardResponse
+	EvacuateShardRequest
+	EvacuateShardResponse
+	EvacuateShardProgress
+*/
+package internal
+
+import proto "github.com/gogo/protobuf/proto"
+import fmt "fmt"
+import math "math"
+import encoding_binary "encoding/binary"
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+type Point struct {
+	Name             *string  `protobuf:"bytes,1,req,name=name" json:"name,omitempty"`
+	Time             *int64   `protobuf:"varint,2,req,name=time" json:"time,omitempty"`
+	Fields           []*Field `protobuf:"bytes,3,rep,name=fields" json:"fields,omitempty"`
+	Tags             []*Tag   `protobuf:"bytes,4,rep,name=tags" json:"tags,omitempty"`
+	XXX_unrecognized []byte   `json:"-"`
+}
+
+func (m *Point) Reset()         { *m = Point{} }
+func (m *Point) String() string { return proto.CompactTextString(m) }
+func (*Point) ProtoMessage()    {}
+
+func (m *Point) GetName() string {
+	if m != nil && m.Name != nil {
+		return *m.Name
+	}
+	return ""
+}
+
+func (m *Point) GetTime() int64 {
+	if m != nil && m.Time != nil {
+		return *m.Time
+	}
+	return 0
+}
+
+func (m *Point) GetFields() []*Field {
+	if m != nil {
+		return m.Fields
+	}
+	return nil
+}
+
+func (m *Point) GetTags() []*Tag {
+	if m != nil {
+		return m.Tags
+	}
+	return nil
+}
+
+type Field struct {
+	Name             *string  `protobuf:"bytes,1,req,name=name" json:"name,omitempty"`
+	Int32            *int32   `protobuf:"varint,2,opt,name=int32" json:"int32,omitempty"`
+	Int64            *int64   `protobuf:"varint,3,opt,name=int64" json:"int64,omitempty"`
+	Float64          *float64 `protobuf:"fixed64,4,opt,name=float64" json:"float64,omitempty"`
+	Bool             *bool    `protobuf:"varint,5,opt,name=bool" json:"bool,omitempty"`
+	String_          *string  `protobuf:"bytes,6,opt,name=string" json:"string,omitempty"`
+	Bytes            []byte   `protobuf:"bytes,7,opt,name=bytes" json:"bytes,omitempty"`
+	XXX_unrecognized []byte   `json:"-"`
+}
+
+func (m *Field) Reset()         { *m = Field{} }
+func (m *Field) String() string { return proto.CompactTextString(m) }
+func (*Field) ProtoMessage()    {}
+
+func (m *Field) GetName() string {
+	if m != nil && m.Name != nil {
+		return *m.Name
+	}
+	return ""
+}
+
+func (m *Field) GetInt32() int32 {
+	if m != nil && m.Int32 != nil {
+		return *m.Int32
+	}
+	return 0
+}
+
+func (m *Field) GetInt64() int64 {
+	if m != nil && m.Int64 != nil {
+		return *m.Int64
+	}
+	return 0
+}
+
+func (m *Field) GetFloat64() float64 {
+	if m != nil && m.Float64 != nil {
+		return *m.Float64
+	}
+	return 0
+}
+
+func (m *Field) GetBool() bool {
+	if m != nil && m.Bool != nil {
+		return *m.Bool
+	}
+	return false
+}
+
+func (m *Field) GetString_() string {
+	if m != nil && m.String_ != nil {
+		return *m.String_
+	}
+	return ""
+}
+
+func (m *Field) GetBytes() []byte {
+	if m != nil {
+		return m.Bytes
+	}
+	return nil
+}
+
+type Tag struct {
+	Key              *string `protobuf:"bytes,1,req,name=key" json:"key,omitempty"`
+	Value            *string `protobuf:"bytes,2,req,name=value" json:"value,omitempty"`
+	XXX_unrecognized []byte  `json:"-"`
+}
+
+func (m *Tag) Reset()         { *m = Tag{} }
+func (m *Tag) String() string { return proto.CompactTextString(m) }
+func (*Tag) ProtoMessage()    {}
+
+func (m *Tag) GetKey() string {
+	if m != nil && m.Key != nil {
+		return *m.Key
+	}
+	return ""
+}
+
+func (m *Tag) GetValue() string {
+	if m != nil && m.Value != nil {
+		return *m.Value
+	}
+	return ""
+}
+
+type MapShardRequest struct {
+	ShardID          *uint64 `protobuf:"varint,1,req,name=ShardID" json:"ShardID,omitempty"`
+	Query            *string `protobuf:"bytes,2,req,name=Query" json:"Query,omitempty"`
+	ChunkSize        *int32  `protobuf:"varint,3,opt,name=ChunkSize" json:"ChunkSize,omitempty"`
+	XXX_unrecognized []byte  `json:"-"`
+}
+
+func (m *MapShardRequest) Reset()         { *m = MapShardRequest{} }
+func (m *MapShardRequest) String() string { return proto.CompactTextString(m) }
+func (*MapShardRequest) ProtoMessage()    {}
+
+func (m *MapShardRequest) GetShardID() uint64 {
+	if m != nil && m.ShardID != nil {
+		return *m.ShardID
+	}
+	return 0
+}
+
+func (m *MapShardRequest) GetQuery() string {
+	if m != nil && m.Query != nil {
+		return *m.Query
+	}
+	return ""
+}
+
+func (m *MapShardRequest) GetChunkSize() int32 {
+	if m != nil && m.ChunkSize != nil {
+		return *m.ChunkSize
+	}
+	return 0
+}
+
+// MapShardResponse_ResponseType distinguishes the frames of a chunked
+// MapShardResponse stream: a single Header frame carrying Code/Message/
+// TagSets/Fields, followed by zero or more Chunk frames each carrying one
+// ChunkSize-bounded slice of Data, terminated by an EOF frame (or an Error
+// frame if the mapper failed partway through).
+type MapShardResponse_ResponseType int32
+
+const (
+	MapShardResponse_HEADER MapShardResponse_ResponseType = 0
+	MapShardResponse_CHUNK  MapShardResponse_ResponseType = 1
+	MapShardResponse_EOF    MapShardResponse_ResponseType = 2
+	MapShardResponse_ERROR  MapShardResponse_ResponseType = 3
+)
+
+var MapShardResponse_ResponseType_name = map[int32]string{
+	0: "HEADER",
+	1: "CHUNK",
+	2: "EOF",
+	3: "ERROR",
+}
+
+func (x MapShardResponse_ResponseType) String() string {
+	if s, ok := MapShardResponse_ResponseType_name[int32(x)]; ok {
+		return s
+	}
+	return fmt.Sprintf("MapShardResponse_ResponseType(%d)", x)
+}
+
+// MapShardResponse_Compression records which codec, if any, was applied to
+// Data before it was set on this message.
+type MapShardResponse_Compression int32
+
+const (
+	MapShardResponse_COMPRESSION_NONE   MapShardResponse_Compression = 0
+	MapShardResponse_COMPRESSION_SNAPPY MapShardResponse_Compression = 1
+)
+
+var MapShardResponse_Compression_name = map[int32]string{
+	0: "COMPRESSION_NONE",
+	1: "COMPRESSION_SNAPPY",
+}
+
+func (x MapShardResponse_Compression) String() string {
+	if s, ok := MapShardResponse_Compression_name[int32(x)]; ok {
+		return s
+	}
+	return fmt.Sprintf("MapShardResponse_Compression(%d)", x)
+}
+
+type MapShardResponse struct {
+	Code             *int32                         `protobuf:"varint,1,opt,name=Code" json:"Code,omitempty"`
+	Message          *string                        `protobuf:"bytes,2,opt,name=Message" json:"Message,omitempty"`
+	TagSets          []string                       `protobuf:"bytes,3,rep,name=TagSets" json:"TagSets,omitempty"`
+	Fields           []string                       `protobuf:"bytes,4,rep,name=Fields" json:"Fields,omitempty"`
+	Data             []byte                         `protobuf:"bytes,5,opt,name=Data" json:"Data,omitempty"`
+	Type             *MapShardResponse_ResponseType `protobuf:"varint,6,opt,name=Type,enum=internal.MapShardResponse_ResponseType" json:"Type,omitempty"`
+	LastChunk        *bool                          `protobuf:"varint,7,opt,name=LastChunk" json:"LastChunk,omitempty"`
+	Compression      *MapShardResponse_Compression  `protobuf:"varint,8,opt,name=Compression,enum=internal.MapShardResponse_Compression" json:"Compression,omitempty"`
+	XXX_unrecognized []byte                         `json:"-"`
+}
+
+func (m *MapShardResponse) Reset()         { *m = MapShardResponse{} }
+func (m *MapShardResponse) String() string { return proto.CompactTextString(m) }
+func (*MapShardResponse) ProtoMessage()    {}
+
+func (m *MapShardResponse) GetCode() int32 {
+	if m != nil && m.Code != nil {
+		return *m.Code
+	}
+	return 0
+}
+
+func (m *MapShardResponse) GetMessage() string {
+	if m != nil && m.Message != nil {
+		return *m.Message
+	}
+	return ""
+}
+
+func (m *MapShardResponse) GetTagSets() []string {
+	if m != nil {
+		return m.TagSets
+	}
+	return nil
+}
+
+func (m *MapShardResponse) GetFields() []string {
+	if m != nil {
+		return m.Fields
+	}
+	return nil
+}
+
+func (m *MapShardResponse) GetData() []byte {
+	if m != nil {
+		return m.Data
+	}
+	return nil
+}
+
+func (m *MapShardResponse) GetType() MapShardResponse_ResponseType {
+	if m != nil && m.Type != nil {
+		return *m.Type
+	}
+	return MapShardResponse_HEADER
+}
+
+func (m *MapShardResponse) GetCompression() MapShardResponse_Compression {
+	if m != nil && m.Compression != nil {
+		return *m.Compression
+	}
+	return MapShardResponse_COMPRESSION_NONE
+}
+
+func (m *MapShardResponse) GetLastChunk() bool {
+	if m != nil && m.LastChunk != nil {
+		return *m.LastChunk
+	}
+	return false
+}
+
+// WriteShardRequest_Compression records which codec, if any, was applied
+// to each of Points' marshaled bytes before MarshalBinaryCompressed
+// produced this message's wire form.
+type WriteShardRequest_Compression int32
+
+const (
+	WriteShardRequest_COMPRESSION_NONE   WriteShardRequest_Compression = 0
+	WriteShardRequest_COMPRESSION_SNAPPY WriteShardRequest_Compression = 1
+)
+
+var WriteShardRequest_Compression_name = map[int32]string{
+	0: "COMPRESSION_NONE",
+	1: "COMPRESSION_SNAPPY",
+}
+
+func (x WriteShardRequest_Compression) String() string {
+	if s, ok := WriteShardRequest_Compression_name[int32(x)]; ok {
+		return s
+	}
+	return fmt.Sprintf("WriteShardRequest_Compression(%d)", x)
+}
+
+type WriteShardRequest struct {
+	ShardID          *uint64                        `protobuf:"varint,1,req,name=ShardID" json:"ShardID,omitempty"`
+	Points           []*Point                       `protobuf:"bytes,2,rep,name=Points" json:"Points,omitempty"`
+	Database         *string                        `protobuf:"bytes,3,opt,name=Database" json:"Database,omitempty"`
+	RetentionPolicy  *string                        `protobuf:"bytes,4,opt,name=RetentionPolicy" json:"RetentionPolicy,omitempty"`
+	ConsistencyLevel *uint32                        `protobuf:"varint,5,opt,name=ConsistencyLevel" json:"ConsistencyLevel,omitempty"`
+	RequestID        *uint64                        `protobuf:"varint,6,opt,name=RequestID" json:"RequestID,omitempty"`
+	Compression      *WriteShardRequest_Compression `protobuf:"varint,7,opt,name=Compression,enum=internal.WriteShardRequest_Compression" json:"Compression,omitempty"`
+	XXX_unrecognized []byte                         `json:"-"`
+}
+
+func (m *WriteShardRequest) Reset()         { *m = WriteShardRequest{} }
+func (m *WriteShardRequest) String() string { return proto.CompactTextString(m) }
+func (*WriteShardRequest) ProtoMessage()    {}
+
+func (m *WriteShardRequest) GetShardID() uint64 {
+	if m != nil && m.ShardID != nil {
+		return *m.ShardID
+	}
+	return 0
+}
+
+func (m *WriteShardRequest) GetPoints() []*Point {
+	if m != nil {
+		return m.Points
+	}
+	return nil
+}
+
+func (m *WriteShardRequest) GetDatabase() string {
+	if m != nil && m.Database != nil {
+		return *m.Database
+	}
+	return ""
+}
+
+func (m *WriteShardRequest) GetRetentionPolicy() string {
+	if m != nil && m.RetentionPolicy != nil {
+		return *m.RetentionPolicy
+	}
+	return ""
+}
+
+func (m *WriteShardRequest) GetConsistencyLevel() uint32 {
+	if m != nil && m.ConsistencyLevel != nil {
+		return *m.ConsistencyLevel
+	}
+	return 0
+}
+
+func (m *WriteShardRequest) GetRequestID() uint64 {
+	if m != nil && m.RequestID != nil {
+		return *m.RequestID
+	}
+	return 0
+}
+
+func (m *WriteShardRequest) GetCompression() WriteShardRequest_Compression {
+	if m != nil && m.Compression != nil {
+		return *m.Compression
+	}
+	return WriteShardRequest_COMPRESSION_NONE
+}
+
+type PointError struct {
+	Index            *uint32 `protobuf:"varint,1,req,name=Index" json:"Index,omitempty"`
+	Reason           *string `protobuf:"bytes,2,opt,name=Reason" json:"Reason,omitempty"`
+	XXX_unrecognized []byte  `json:"-"`
+}
+
+func (m *PointError) Reset()         { *m = PointError{} }
+func (m *PointError) String() string { return proto.CompactTextString(m) }
+func (*PointError) ProtoMessage()    {}
+
+func (m *PointError) GetIndex() uint32 {
+	if m != nil && m.Index != nil {
+		return *m.Index
+	}
+	return 0
+}
+
+func (m *PointError) GetReason() string {
+	if m != nil && m.Reason != nil {
+		return *m.Reason
+	}
+	return ""
+}
+
+type WriteShardResponse struct {
+	Code             *int32        `protobuf:"varint,1,req,name=Code" json:"Code,omitempty"`
+	Message          *string       `protobuf:"bytes,2,opt,name=Message" json:"Message,omitempty"`
+	PointsWritten    *uint64       `protobuf:"varint,3,opt,name=PointsWritten" json:"PointsWritten,omitempty"`
+	PointsDropped    *uint64       `protobuf:"varint,4,opt,name=PointsDropped" json:"PointsDropped,omitempty"`
+	PointErrors      []*PointError `protobuf:"bytes,5,rep,name=PointErrors" json:"PointErrors,omitempty"`
+	XXX_unrecognized []byte        `json:"-"`
+}
+
+func (m *WriteShardResponse) Reset()         { *m = WriteShardResponse{} }
+func (m *WriteShardResponse) String() string { return proto.CompactTextString(m) }
+func (*WriteShardResponse) ProtoMessage()    {}
+
+func (m *WriteShardResponse) GetCode() int32 {
+	if m != nil && m.Code != nil {
+		return *m.Code
+	}
+	return 0
+}
+
+func (m *WriteShardResponse) GetMessage() string {
+	if m != nil && m.Message != nil {
+		return *m.Message
+	}
+	return ""
+}
+
+func (m *WriteShardResponse) GetPointsWritten() uint64 {
+	if m != nil && m.PointsWritten != nil {
+		return *m.PointsWritten
+	}
+	return 0
+}
+
+func (m *WriteShardResponse) GetPointsDropped() uint64 {
+	if m != nil && m.PointsDropped != nil {
+		return *m.PointsDropped
+	}
+	return 0
+}
+
+func (m *WriteShardResponse) GetPointErrors() []*PointError {
+	if m != nil {
+		return m.PointErrors
+	}
+	return nil
+}
+
+type EvacuateShardRequest struct {
+	ShardID            *uint64  `protobuf:"varint,1,req,name=ShardID" json:"ShardID,omitempty"`
+	DestinationNodeIDs []uint64 `protobuf:"varint,2,rep,name=DestinationNodeIDs" json:"DestinationNodeIDs,omitempty"`
+	IgnoreErrors       *bool    `protobuf:"varint,3,opt,name=IgnoreErrors" json:"IgnoreErrors,omitempty"`
+	BatchSize          *int32   `protobuf:"varint,4,opt,name=BatchSize" json:"BatchSize,omitempty"`
+	Database           *string  `protobuf:"bytes,5,opt,name=Database" json:"Database,omitempty"`
+	RetentionPolicy    *string  `protobuf:"bytes,6,opt,name=RetentionPolicy" json:"RetentionPolicy,omitempty"`
+	XXX_unrecognized   []byte   `json:"-"`
+}
+
+func (m *EvacuateShardRequest) Reset()         { *m = EvacuateShardRequest{} }
+func (m *EvacuateShardRequest) String() string { return proto.CompactTextString(m) }
+func (*EvacuateShardRequest) ProtoMessage()    {}
+
+func (m *EvacuateShardRequest) GetShardID() uint64 {
+	if m != nil && m.ShardID != nil {
+		return *m.ShardID
+	}
+	return 0
+}
+
+func (m *EvacuateShardRequest) GetDestinationNodeIDs() []uint64 {
+	if m != nil {
+		return m.DestinationNodeIDs
+	}
+	return nil
+}
+
+func (m *EvacuateShardRequest) GetIgnoreErrors() bool {
+	if m != nil && m.IgnoreErrors != nil {
+		return *m.IgnoreErrors
+	}
+	return false
+}
+
+func (m *EvacuateShardRequest) GetBatchSize() int32 {
+	if m != nil && m.BatchSize != nil {
+		return *m.BatchSize
+	}
+	return 0
+}
+
+func (m *EvacuateShardRequest) GetDatabase() string {
+	if m != nil && m.Database != nil {
+		return *m.Database
+	}
+	return ""
+}
+
+func (m *EvacuateShardRequest) GetRetentionPolicy() string {
+	if m != nil && m.RetentionPolicy != nil {
+		return *m.RetentionPolicy
+	}
+	return ""
+}
+
+type EvacuateShardResponse struct {
+	Code             *int32   `protobuf:"varint,1,req,name=Code" json:"Code,omitempty"`
+	Message          *string  `protobuf:"bytes,2,opt,name=Message" json:"Message,omitempty"`
+	ObjectsMoved     *uint64  `protobuf:"varint,3,opt,name=ObjectsMoved" json:"ObjectsMoved,omitempty"`
+	ObjectsSkipped   *uint64  `protobuf:"varint,4,opt,name=ObjectsSkipped" json:"ObjectsSkipped,omitempty"`
+	Errors           []string `protobuf:"bytes,5,rep,name=Errors" json:"Errors,omitempty"`
+	XXX_unrecognized []byte   `json:"-"`
+}
+
+func (m *EvacuateShardResponse) Reset()         { *m = EvacuateShardResponse{} }
+func (m *EvacuateShardResponse) String() string { return proto.CompactTextString(m) }
+func (*EvacuateShardResponse) ProtoMessage()    {}
+
+func (m *EvacuateShardResponse) GetCode() int32 {
+	if m != nil && m.Code != nil {
+		return *m.Code
+	}
+	return 0
+}
+
+func (m *EvacuateShardResponse) GetMessage() string {
+	if m != nil && m.Message != nil {
+		return *m.Message
+	}
+	return ""
+}
+
+func (m *EvacuateShardResponse) GetObjectsMoved() uint64 {
+	if m != nil && m.ObjectsMoved != nil {
+		return *m.ObjectsMoved
+	}
+	return 0
+}
+
+func (m *EvacuateShardResponse) GetObjectsSkipped() uint64 {
+	if m != nil && m.ObjectsSkipped != nil {
+		return *m.ObjectsSkipped
+	}
+	return 0
+}
+
+func (m *EvacuateShardResponse) GetErrors() []string {
+	if m != nil {
+		return m.Errors
+	}
+	return nil
+}
+
+type EvacuateShardProgress struct {
+	Moved            *uint64 `protobuf:"varint,1,req,name=Moved" json:"Moved,omitempty"`
+	Remaining        *uint64 `protobuf:"varint,2,req,name=Remaining" json:"Remaining,omitempty"`
+	XXX_unrecognized []byte  `json:"-"`
+}
+
+func (m *EvacuateShardProgress) Reset()         { *m = EvacuateShardProgress{} }
+func (m *EvacuateShardProgress) String() string { return proto.CompactTextString(m) }
+func (*EvacuateShardProgress) ProtoMessage()    {}
+
+func (m *EvacuateShardProgress) GetMoved() uint64 {
+	if m != nil && m.Moved != nil {
+		return *m.Moved
+	}
+	return 0
+}
+
+func (m *EvacuateShardProgress) GetRemaining() uint64 {
+	if m != nil && m.Remaining != nil {
+		return *m.Remaining
+	}
+	return 0
+}
+
+// The Marshal/Size methods below are hand-written rather than
+// protoc-gen-gogo generated output. WriteShardRequest sits on the
+// cluster's hot write path, and round-tripping every point through the
+// reflection-based proto.Marshal (via an intermediate marshalPoints tree,
+// see rpc.go) costs an allocation per field and per tag. These give
+// WriteShardRequest (and the Point/Field/Tag messages it's built from) a
+// zero-allocation MarshalTo that writes directly into a caller-supplied
+// buffer, while Unmarshal continues to go through proto.Unmarshal, since
+// it is wire-format/order-agnostic and does not care how the bytes were
+// produced.
+
+func encodeVarintData(dAtA []byte, offset int, v uint64) int {
+	for v >= 1<<7 {
+		dAtA[offset] = uint8(v&0x7f | 0x80)
+		v >>= 7
+		offset++
+	}
+	dAtA[offset] = uint8(v)
+	return offset + 1
+}
+
+func sovData(v uint64) (n int) {
+	for {
+		n++
+		v >>= 7
+		if v == 0 {
+			break
+		}
+	}
+	return n
+}
+
+func (m *Tag) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	if m.Key != nil {
+		l := len(*m.Key)
+		n += 1 + l + sovData(uint64(l))
+	}
+	if m.Value != nil {
+		l := len(*m.Value)
+		n += 1 + l + sovData(uint64(l))
+	}
+	n += len(m.XXX_unrecognized)
+	return n
+}
+
+// MarshalTo writes the encoded form of m to dAtA, which must be at least
+// m.Size() bytes long, and returns the number of bytes written.
+func (m *Tag) MarshalTo(dAtA []byte) (int, error) {
+	var i int
+	if m.Key != nil {
+		dAtA[i] = 0xa
+		i++
+		i = encodeVarintData(dAtA, i, uint64(len(*m.Key)))
+		i += copy(dAtA[i:], *m.Key)
+	}
+	if m.Value != nil {
+		dAtA[i] = 0x12
+		i++
+		i = encodeVarintData(dAtA, i, uint64(len(*m.Value)))
+		i += copy(dAtA[i:], *m.Value)
+	}
+	i += copy(dAtA[i:], m.XXX_unrecognized)
+	return i, nil
+}
+
+func (m *Field) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	if m.Name != nil {
+		l := len(*m.Name)
+		n += 1 + l + sovData(uint64(l))
+	}
+	if m.Int32 != nil {
+		n += 1 + sovData(uint64(*m.Int32))
+	}
+	if m.Int64 != nil {
+		n += 1 + sovData(uint64(*m.Int64))
+	}
+	if m.Float64 != nil {
+		n += 9
+	}
+	if m.Bool != nil {
+		n += 2
+	}
+	if m.String_ != nil {
+		l := len(*m.String_)
+		n += 1 + l + sovData(uint64(l))
+	}
+	if m.Bytes != nil {
+		l := len(m.Bytes)
+		n += 1 + l + sovData(uint64(l))
+	}
+	n += len(m.XXX_unrecognized)
+	return n
+}
+
+func (m *Field) MarshalTo(dAtA []byte) (int, error) {
+	var i int
+	if m.Name != nil {
+		dAtA[i] = 0xa
+		i++
+		i = encodeVarintData(dAtA, i, uint64(len(*m.Name)))
+		i += copy(dAtA[i:], *m.Name)
+	}
+	if m.Int32 != nil {
+		dAtA[i] = 0x10
+		i++
+		i = encodeVarintData(dAtA, i, uint64(*m.Int32))
+	}
+	if m.Int64 != nil {
+		dAtA[i] = 0x18
+		i++
+		i = encodeVarintData(dAtA, i, uint64(*m.Int64))
+	}
+	if m.Float64 != nil {
+		dAtA[i] = 0x21
+		i++
+		encoding_binary.LittleEndian.PutUint64(dAtA[i:], math.Float64bits(*m.Float64))
+		i += 8
+	}
+	if m.Bool != nil {
+		dAtA[i] = 0x28
+		i++
+		if *m.Bool {
+			dAtA[i] = 1
+		} else {
+			dAtA[i] = 0
+		}
+		i++
+	}
+	if m.String_ != nil {
+		dAtA[i] = 0x32
+		i++
+		i = encodeVarintData(dAtA, i, uint64(len(*m.String_)))
+		i += copy(dAtA[i:], *m.String_)
+	}
+	if m.Bytes != nil {
+		dAtA[i] = 0x3a
+		i++
+		i = encodeVarintData(dAtA, i, uint64(len(m.Bytes)))
+		i += copy(dAtA[i:], m.Bytes)
+	}
+	i += copy(dAtA[i:], m.XXX_unrecognized)
+	return i, nil
+}
+
+func (m *Point) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	if m.Name != nil {
+		l := len(*m.Name)
+		n += 1 + l + sovData(uint64(l))
+	}
+	n += 1 + sovData(uint64(*m.Time))
+	for _, f := range m.Fields {
+		l := f.Size()
+		n += 1 + l + sovData(uint64(l))
+	}
+	for _, t := range m.Tags {
+		l := t.Size()
+		n += 1 + l + sovData(uint64(l))
+	}
+	n += len(m.XXX_unrecognized)
+	return n
+}
+
+func (m *Point) MarshalTo(dAtA []byte) (int, error) {
+	var i int
+	if m.Name != nil {
+		dAtA[i] = 0xa
+		i++
+		i = encodeVarintData(dAtA, i, uint64(len(*m.Name)))
+		i += copy(dAtA[i:], *m.Name)
+	}
+	if m.Time != nil {
+		dAtA[i] = 0x10
+		i++
+		i = encodeVarintData(dAtA, i, uint64(*m.Time))
+	}
+	for _, f := range m.Fields {
+		dAtA[i] = 0x1a
+		i++
+		i = encodeVarintData(dAtA, i, uint64(f.Size()))
+		n, err := f.MarshalTo(dAtA[i:])
+		if err != nil {
+			return 0, err
+		}
+		i += n
+	}
+	for _, t := range m.Tags {
+		dAtA[i] = 0x22
+		i++
+		i = encodeVarintData(dAtA, i, uint64(t.Size()))
+		n, err := t.MarshalTo(dAtA[i:])
+		if err != nil {
+			return 0, err
+		}
+		i += n
+	}
+	i += copy(dAtA[i:], m.XXX_unrecognized)
+	return i, nil
+}
+
+func (m *WriteShardRequest) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	n += 1 + sovData(uint64(*m.ShardID))
+	for _, p := range m.Points {
+		l := p.Size()
+		n += 1 + l + sovData(uint64(l))
+	}
+	if m.Database != nil {
+		l := len(*m.Database)
+		n += 1 + l + sovData(uint64(l))
+	}
+	if m.RetentionPolicy != nil {
+		l := len(*m.RetentionPolicy)
+		n += 1 + l + sovData(uint64(l))
+	}
+	if m.ConsistencyLevel != nil {
+		n += 1 + sovData(uint64(*m.ConsistencyLevel))
+	}
+	if m.RequestID != nil {
+		n += 1 + sovData(*m.RequestID)
+	}
+	if m.Compression != nil {
+		n += 1 + sovData(uint64(*m.Compression))
+	}
+	n += len(m.XXX_unrecognized)
+	return n
+}
+
+// MarshalTo writes the encoded form of m to dAtA, which must be at least
+// m.Size() bytes long, and returns the number of bytes written. It is the
+// zero-allocation counterpart to proto.Marshal(m) used by
+// WriteShardRequest.MarshalToBuffer on the write path.
+func (m *WriteShardRequest) MarshalTo(dAtA []byte) (int, error) {
+	var i int
+	if m.ShardID != nil {
+		dAtA[i] = 0x8
+		i++
+		i = encodeVarintData(dAtA, i, uint64(*m.ShardID))
+	}
+	for _, p := range m.Points {
+		dAtA[i] = 0x12
+		i++
+		i = encodeVarintData(dAtA, i, uint64(p.Size()))
+		n, err := p.MarshalTo(dAtA[i:])
+		if err != nil {
+			return 0, err
+		}
+		i += n
+	}
+	if m.Database != nil {
+		dAtA[i] = 0x1a
+		i++
+		i = encodeVarintData(dAtA, i, uint64(len(*m.Database)))
+		i += copy(dAtA[i:], *m.Database)
+	}
+	if m.RetentionPolicy != nil {
+		dAtA[i] = 0x22
+		i++
+		i = encodeVarintData(dAtA, i, uint64(len(*m.RetentionPolicy)))
+		i += copy(dAtA[i:], *m.RetentionPolicy)
+	}
+	if m.ConsistencyLevel != nil {
+		dAtA[i] = 0x28
+		i++
+		i = encodeVarintData(dAtA, i, uint64(*m.ConsistencyLevel))
+	}
+	if m.RequestID != nil {
+		dAtA[i] = 0x30
+		i++
+		i = encodeVarintData(dAtA, i, *m.RequestID)
+	}
+	if m.Compression != nil {
+		dAtA[i] = 0x38
+		i++
+		i = encodeVarintData(dAtA, i, uint64(*m.Compression))
+	}
+	i += copy(dAtA[i:], m.XXX_unrecognized)
+	return i, nil
+}
+
+func init() {
+}
@@ -0,0 +1,232 @@
+package cluster
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+
+	"github.com/influxdb/influxdb/tsdb"
+)
+
+// ShardWriter writes a batch of points to the shard owned by ownerID on a
+// remote node, the same replication primitive the normal ingest path uses
+// to fan a WritePointsRequest out to every shard owner. database and
+// retentionPolicy identify the points' origin so a network implementation
+// can populate WriteShardRequest.SetDatabase/SetRetentionPolicy: ownerID's
+// shard is created independently on each node, so the receiving node may
+// not have a shard with that exact ID and must resolve its local shard by
+// (database, retentionPolicy, shardID) instead. requestID and level are
+// likewise forwarded onto WriteShardRequest.SetRequestID/
+// SetConsistencyLevel, so a replica can make its own hinted-handoff
+// decision and its response can be matched back up with the write it
+// answers. The returned *WriteShardResponse is nil only when err is
+// non-nil (the replica was never reached, or never answered).
+type ShardWriter interface {
+	WriteShard(shardID, ownerID uint64, database, retentionPolicy string, requestID uint64, level ConsistencyLevel, points []tsdb.Point) (*WriteShardResponse, error)
+}
+
+// ShardReader reads back points already stored in a local shard, in
+// batches of at most n, until the shard is exhausted.
+type ShardReader interface {
+	ReadShard(shardID uint64, n int) ([]tsdb.Point, error)
+
+	// CountPoints returns the total number of points currently stored in
+	// shardID, so EvacuateShard can report how many remain as it drains
+	// the shard in batches.
+	CountPoints(shardID uint64) (uint64, error)
+}
+
+var (
+	// ErrPartialWrite is returned when a write satisfied its consistency
+	// level, but one or more points in the batch were rejected by at least
+	// one replica.
+	ErrPartialWrite = errors.New("partial write")
+
+	// ErrWriteFailed is returned when a write could not satisfy its
+	// consistency level: too few replicas answered without error. A
+	// replica that answered but dropped points still counts towards the
+	// level.
+	ErrWriteFailed = errors.New("write failed")
+)
+
+// writeResult is one replica's outcome for a single WriteShardRequest.
+type writeResult struct {
+	response *WriteShardResponse
+	err      error
+}
+
+// requestIDCounter hands out the RequestID every ShardWriter.WriteShard
+// call carries on the wire, so replicas and the evacuation drain can each
+// correlate a response with the write that produced it.
+var requestIDCounter uint64
+
+// nextRequestID returns a process-wide unique RequestID.
+func nextRequestID() uint64 {
+	return atomic.AddUint64(&requestIDCounter, 1)
+}
+
+// requiredWrites returns how many of n replicas must succeed to satisfy
+// level.
+func requiredWrites(level ConsistencyLevel, n int) int {
+	switch level {
+	case ConsistencyLevelAny, ConsistencyLevelOne:
+		return 1
+	case ConsistencyLevelAll:
+		return n
+	case ConsistencyLevelQuorum:
+		return n/2 + 1
+	default:
+		return n
+	}
+}
+
+// checkWriteConsistency aggregates the per-replica results of writing the
+// same batch of points to n shard owners, and decides whether level was
+// met. It returns ErrWriteFailed if too few replicas responded without
+// error, ErrPartialWrite if level was met but at least one replica
+// reported per-point errors, or nil if every responding replica wrote the
+// whole batch.
+func checkWriteConsistency(level ConsistencyLevel, n int, results []writeResult) error {
+	required := requiredWrites(level, n)
+
+	ok := 0
+	partial := false
+	for _, r := range results {
+		if r.err != nil {
+			continue
+		}
+		ok++
+		if r.response.PointsDropped() > 0 || len(r.response.PointErrors()) > 0 {
+			partial = true
+		}
+	}
+
+	if ok < required {
+		return ErrWriteFailed
+	}
+	if partial {
+		return ErrPartialWrite
+	}
+	return nil
+}
+
+// PointsWriter coordinates a single logical write across every owner of a
+// shard: it gives every replica the same RequestID so a receiver can
+// correlate its response with the write that produced it, then aggregates
+// the per-replica results with checkWriteConsistency to decide whether
+// ConsistencyLevel was satisfied.
+type PointsWriter struct {
+	ShardWriter ShardWriter
+}
+
+// NewPointsWriter returns a PointsWriter that replicates through w.
+func NewPointsWriter(w ShardWriter) *PointsWriter {
+	return &PointsWriter{ShardWriter: w}
+}
+
+// WriteShard writes req.Points to shardID on every owner in ownerIDs
+// concurrently, and returns the same errors checkWriteConsistency does:
+// ErrWriteFailed if req.ConsistencyLevel wasn't met, ErrPartialWrite if it
+// was met but at least one replica dropped points, or nil if every
+// replica that answered wrote the whole batch.
+func (p *PointsWriter) WriteShard(shardID uint64, ownerIDs []uint64, req *WritePointsRequest) error {
+	requestID := nextRequestID()
+
+	results := make([]writeResult, len(ownerIDs))
+	var wg sync.WaitGroup
+	wg.Add(len(ownerIDs))
+	for i, ownerID := range ownerIDs {
+		go func(i int, ownerID uint64) {
+			defer wg.Done()
+			resp, err := p.ShardWriter.WriteShard(shardID, ownerID, req.Database, req.RetentionPolicy, requestID, req.ConsistencyLevel, req.Points)
+			results[i] = writeResult{response: resp, err: err}
+		}(i, ownerID)
+	}
+	wg.Wait()
+
+	return checkWriteConsistency(req.ConsistencyLevel, len(ownerIDs), results)
+}
+
+// defaultEvacuateBatchSize is used when an EvacuateShardRequest leaves
+// BatchSize unset.
+const defaultEvacuateBatchSize = 1000
+
+// EvacuateShard drains req.ShardID from the local node onto
+// req.DestinationNodeIDs, reading it back in BatchSize-bounded batches via
+// r and replicating each batch with w, the same ShardWriter used by the
+// normal ingest path. onProgress, if non-nil, is called after each batch
+// with the running moved count and the number of points r reported at the
+// start of the drain that have yet to be moved or skipped, for a caller to
+// forward as EvacuateShardProgress frames.
+//
+// A batch that w fails to replicate to every destination aborts the drain
+// unless req.IgnoreErrors is set, in which case the batch is counted as
+// skipped and evacuation continues with the next one.
+func EvacuateShard(r ShardReader, w ShardWriter, req *EvacuateShardRequest, onProgress func(moved, remaining uint64)) *EvacuateShardResponse {
+	batchSize := int(req.BatchSize())
+	if batchSize <= 0 {
+		batchSize = defaultEvacuateBatchSize
+	}
+
+	resp := &EvacuateShardResponse{}
+
+	total, err := r.CountPoints(req.ShardID())
+	if err != nil {
+		resp.SetCode(1)
+		resp.SetMessage(err.Error())
+		return resp
+	}
+
+	var moved, skipped uint64
+	remaining := func() uint64 {
+		done := moved + skipped
+		if done > total {
+			return 0
+		}
+		return total - done
+	}
+
+	for {
+		points, err := r.ReadShard(req.ShardID(), batchSize)
+		if err != nil {
+			resp.SetCode(1)
+			resp.SetMessage(err.Error())
+			resp.SetObjectsMoved(moved)
+			resp.SetObjectsSkipped(skipped)
+			return resp
+		}
+		if len(points) == 0 {
+			break
+		}
+
+		batchRequestID := nextRequestID()
+		var batchFailed bool
+		for _, destID := range req.DestinationNodeIDs() {
+			if _, err := w.WriteShard(req.ShardID(), destID, req.Database(), req.RetentionPolicy(), batchRequestID, ConsistencyLevelAny, points); err != nil {
+				if !req.IgnoreErrors() {
+					resp.SetCode(1)
+					resp.SetMessage(err.Error())
+					resp.SetObjectsMoved(moved)
+					resp.SetObjectsSkipped(skipped)
+					return resp
+				}
+				resp.AddError(err.Error())
+				batchFailed = true
+			}
+		}
+
+		if batchFailed {
+			skipped += uint64(len(points))
+		} else {
+			moved += uint64(len(points))
+		}
+		if onProgress != nil {
+			onProgress(moved, remaining())
+		}
+	}
+
+	resp.SetCode(0)
+	resp.SetObjectsMoved(moved)
+	resp.SetObjectsSkipped(skipped)
+	return resp
+}
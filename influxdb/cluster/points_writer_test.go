@@ -0,0 +1,252 @@
+package cluster
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/influxdb/influxdb/tsdb"
+)
+
+func TestCheckWriteConsistency(t *testing.T) {
+	cleanResp := &WriteShardResponse{}
+	cleanResp.SetPointsWritten(10)
+
+	droppedResp := &WriteShardResponse{}
+	droppedResp.SetPointsWritten(9)
+	droppedResp.SetPointsDropped(1)
+	droppedResp.AddPointError(3, "field type conflict")
+
+	ok := writeResult{response: cleanResp}
+	dropped := writeResult{response: droppedResp}
+	failed := writeResult{err: errors.New("boom")}
+
+	tests := []struct {
+		name    string
+		level   ConsistencyLevel
+		n       int
+		results []writeResult
+		want    error
+	}{
+		{"quorum met, clean", ConsistencyLevelQuorum, 3, []writeResult{ok, ok, failed}, nil},
+		{"quorum met, partial", ConsistencyLevelQuorum, 3, []writeResult{ok, dropped, failed}, ErrPartialWrite},
+		{"quorum not met", ConsistencyLevelQuorum, 3, []writeResult{ok, failed, failed}, ErrWriteFailed},
+		{"all met", ConsistencyLevelAll, 2, []writeResult{ok, ok}, nil},
+		{"all not met", ConsistencyLevelAll, 2, []writeResult{ok, failed}, ErrWriteFailed},
+		{"any satisfied by one", ConsistencyLevelAny, 3, []writeResult{ok, failed, failed}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := checkWriteConsistency(tt.level, tt.n, tt.results); got != tt.want {
+				t.Errorf("checkWriteConsistency(%v, %d) = %v, want %v", tt.level, tt.n, got, tt.want)
+			}
+		})
+	}
+}
+
+// fakeShardReader serves points from an in-memory slice, batchSize at a
+// time, as ShardReader.ReadShard requires.
+type fakeShardReader struct {
+	points []tsdb.Point
+}
+
+func (f *fakeShardReader) ReadShard(shardID uint64, n int) ([]tsdb.Point, error) {
+	if len(f.points) == 0 {
+		return nil, nil
+	}
+	if n > len(f.points) {
+		n = len(f.points)
+	}
+	batch := f.points[:n]
+	f.points = f.points[n:]
+	return batch, nil
+}
+
+func (f *fakeShardReader) CountPoints(shardID uint64) (uint64, error) {
+	return uint64(len(f.points)), nil
+}
+
+// fakeShardWriter records every WriteShard call, optionally failing writes
+// to a configured destination node or reporting a partial write for one.
+// Its fields are guarded by mu since PointsWriter.WriteShard calls
+// WriteShard concurrently, one goroutine per destination.
+type fakeShardWriter struct {
+	mu         sync.Mutex
+	failDest   map[uint64]bool
+	dropDest   map[uint64]uint64
+	writes     int
+	dbs        []string
+	rps        []string
+	requestIDs []uint64
+	levels     []ConsistencyLevel
+}
+
+func (f *fakeShardWriter) WriteShard(shardID, ownerID uint64, database, retentionPolicy string, requestID uint64, level ConsistencyLevel, points []tsdb.Point) (*WriteShardResponse, error) {
+	f.mu.Lock()
+	f.writes++
+	f.dbs = append(f.dbs, database)
+	f.rps = append(f.rps, retentionPolicy)
+	f.requestIDs = append(f.requestIDs, requestID)
+	f.levels = append(f.levels, level)
+	f.mu.Unlock()
+
+	if f.failDest[ownerID] {
+		return nil, errors.New("destination unreachable")
+	}
+
+	resp := &WriteShardResponse{}
+	if dropped := f.dropDest[ownerID]; dropped > 0 {
+		resp.SetPointsWritten(uint64(len(points)) - dropped)
+		resp.SetPointsDropped(dropped)
+		resp.AddPointError(0, "field type conflict")
+	} else {
+		resp.SetPointsWritten(uint64(len(points)))
+	}
+	return resp, nil
+}
+
+func TestEvacuateShard(t *testing.T) {
+	points := make([]tsdb.Point, 5)
+	for i := range points {
+		points[i] = tsdb.NewPoint("cpu", nil, map[string]interface{}{"value": i}, time.Unix(0, int64(i)))
+	}
+
+	req := &EvacuateShardRequest{}
+	req.SetShardID(1)
+	req.SetDestinationNodeIDs([]uint64{2, 3})
+	req.SetBatchSize(2)
+	req.SetDatabase("mydb")
+	req.SetRetentionPolicy("autogen")
+
+	fw := &fakeShardWriter{}
+	resp := EvacuateShard(&fakeShardReader{points: points}, fw, req, nil)
+	if resp.Code() != 0 {
+		t.Fatalf("Code() = %d, want 0: %s", resp.Code(), resp.Message())
+	}
+	if got, want := resp.ObjectsMoved(), uint64(5); got != want {
+		t.Errorf("ObjectsMoved() = %d, want %d", got, want)
+	}
+	if got := resp.ObjectsSkipped(); got != 0 {
+		t.Errorf("ObjectsSkipped() = %d, want 0", got)
+	}
+	for i, db := range fw.dbs {
+		if db != "mydb" || fw.rps[i] != "autogen" {
+			t.Errorf("WriteShard call %d got (database, retentionPolicy) = (%q, %q), want (%q, %q)", i, db, fw.rps[i], "mydb", "autogen")
+		}
+	}
+}
+
+func TestEvacuateShardProgress(t *testing.T) {
+	points := make([]tsdb.Point, 5)
+	for i := range points {
+		points[i] = tsdb.NewPoint("cpu", nil, map[string]interface{}{"value": i}, time.Unix(0, int64(i)))
+	}
+
+	req := &EvacuateShardRequest{}
+	req.SetShardID(1)
+	req.SetDestinationNodeIDs([]uint64{2})
+	req.SetBatchSize(2)
+
+	var moved, remaining []uint64
+	onProgress := func(m, r uint64) {
+		moved = append(moved, m)
+		remaining = append(remaining, r)
+	}
+
+	resp := EvacuateShard(&fakeShardReader{points: points}, &fakeShardWriter{}, req, onProgress)
+	if resp.Code() != 0 {
+		t.Fatalf("Code() = %d, want 0: %s", resp.Code(), resp.Message())
+	}
+
+	wantMoved := []uint64{2, 4, 5}
+	wantRemaining := []uint64{3, 1, 0}
+	if len(moved) != len(wantMoved) {
+		t.Fatalf("onProgress called %d times, want %d", len(moved), len(wantMoved))
+	}
+	for i := range wantMoved {
+		if moved[i] != wantMoved[i] || remaining[i] != wantRemaining[i] {
+			t.Errorf("call %d: onProgress(%d, %d), want onProgress(%d, %d)", i, moved[i], remaining[i], wantMoved[i], wantRemaining[i])
+		}
+	}
+}
+
+func TestEvacuateShardIgnoreErrors(t *testing.T) {
+	points := make([]tsdb.Point, 4)
+	for i := range points {
+		points[i] = tsdb.NewPoint("cpu", nil, map[string]interface{}{"value": i}, time.Unix(0, int64(i)))
+	}
+
+	req := &EvacuateShardRequest{}
+	req.SetShardID(1)
+	req.SetDestinationNodeIDs([]uint64{2})
+	req.SetBatchSize(2)
+	req.SetIgnoreErrors(true)
+
+	resp := EvacuateShard(&fakeShardReader{points: points}, &fakeShardWriter{failDest: map[uint64]bool{2: true}}, req, nil)
+	if resp.Code() != 0 {
+		t.Fatalf("Code() = %d, want 0: %s", resp.Code(), resp.Message())
+	}
+	if got, want := resp.ObjectsSkipped(), uint64(4); got != want {
+		t.Errorf("ObjectsSkipped() = %d, want %d", got, want)
+	}
+	if got := resp.ObjectsMoved(); got != 0 {
+		t.Errorf("ObjectsMoved() = %d, want 0", got)
+	}
+	if len(resp.Errors()) == 0 {
+		t.Errorf("Errors() is empty, want the per-destination failures recorded")
+	}
+}
+
+func TestPointsWriterWriteShard(t *testing.T) {
+	points := []tsdb.Point{tsdb.NewPoint("cpu", nil, map[string]interface{}{"value": 1}, time.Unix(0, 0))}
+
+	tests := []struct {
+		name  string
+		level ConsistencyLevel
+		fw    *fakeShardWriter
+		want  error
+	}{
+		{"quorum met, clean", ConsistencyLevelQuorum, &fakeShardWriter{}, nil},
+		{"all not met", ConsistencyLevelAll, &fakeShardWriter{failDest: map[uint64]bool{3: true}}, ErrWriteFailed},
+		{"one met, partial", ConsistencyLevelOne, &fakeShardWriter{dropDest: map[uint64]uint64{2: 1}}, ErrPartialWrite},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pw := NewPointsWriter(tt.fw)
+			req := &WritePointsRequest{Database: "mydb", RetentionPolicy: "autogen", ConsistencyLevel: tt.level, Points: points}
+			if got := pw.WriteShard(1, []uint64{2, 3}, req); got != tt.want {
+				t.Errorf("WriteShard() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPointsWriterWriteShardSharesRequestID(t *testing.T) {
+	fw := &fakeShardWriter{}
+	pw := NewPointsWriter(fw)
+	points := []tsdb.Point{tsdb.NewPoint("cpu", nil, map[string]interface{}{"value": 1}, time.Unix(0, 0))}
+	req := &WritePointsRequest{Database: "mydb", RetentionPolicy: "autogen", ConsistencyLevel: ConsistencyLevelAll, Points: points}
+	if err := pw.WriteShard(1, []uint64{2, 3}, req); err != nil {
+		t.Fatalf("WriteShard() = %v, want nil", err)
+	}
+
+	if len(fw.requestIDs) != 2 || fw.requestIDs[0] != fw.requestIDs[1] {
+		t.Errorf("requestIDs = %v, want both replicas to share one RequestID", fw.requestIDs)
+	}
+}
+
+func TestEvacuateShardAbortsWithoutIgnoreErrors(t *testing.T) {
+	points := []tsdb.Point{tsdb.NewPoint("cpu", nil, map[string]interface{}{"value": 1}, time.Unix(0, 0))}
+
+	req := &EvacuateShardRequest{}
+	req.SetShardID(1)
+	req.SetDestinationNodeIDs([]uint64{2})
+
+	resp := EvacuateShard(&fakeShardReader{points: points}, &fakeShardWriter{failDest: map[uint64]bool{2: true}}, req, nil)
+	if resp.Code() == 0 {
+		t.Fatalf("Code() = 0, want a non-zero failure code")
+	}
+}
@@ -4,10 +4,26 @@ import (
 	"time"
 
 	"github.com/gogo/protobuf/proto"
+	"github.com/golang/snappy"
 	"github.com/influxdb/influxdb/cluster/internal"
 	"github.com/influxdb/influxdb/tsdb"
 )
 
+// Compression identifies the codec, if any, applied to a WriteShardRequest
+// or MapShardResponse payload before it went out on the wire. The peers on
+// a connection settle on one of these during the TCP mux handshake (see
+// negotiateCompression); Compression field values on individual messages
+// only ever matter for as long as the connection that produced them is
+// being read.
+type Compression int
+
+const (
+	// CompressionNone ships the raw marshaled protobuf.
+	CompressionNone Compression = iota
+	// CompressionSnappy ships the marshaled protobuf through snappy.
+	CompressionSnappy
+)
+
 //go:generate protoc --gogo_out=. internal/data.proto
 
 // MapShardRequest represents the request to map a remote shard for a query.
@@ -54,12 +70,51 @@ func (r *MapShardResponse) TagSets() []string { return r.pb.GetTagSets() }
 func (r *MapShardResponse) Fields() []string  { return r.pb.GetFields() }
 func (r *MapShardResponse) Data() []byte      { return r.pb.GetData() }
 
+// Type reports which frame of a chunked response this is. A stream that
+// isn't chunked (e.g. one built directly via NewMapShardResponse rather
+// than read off the wire) reports ResponseHeader, its zero value.
+func (r *MapShardResponse) Type() ResponseType { return ResponseType(r.pb.GetType()) }
+
+// LastChunk reports whether this is the final Data-bearing frame of a
+// chunked response; the stream's true terminator is still a ResponseEOF
+// frame, which carries no data of its own.
+func (r *MapShardResponse) LastChunk() bool { return r.pb.GetLastChunk() }
+
 func (r *MapShardResponse) SetCode(code int)            { r.pb.Code = proto.Int32(int32(code)) }
 func (r *MapShardResponse) SetMessage(message string)   { r.pb.Message = &message }
 func (r *MapShardResponse) SetTagSets(tagsets []string) { r.pb.TagSets = tagsets }
 func (r *MapShardResponse) SetFields(fields []string)   { r.pb.Fields = fields }
 func (r *MapShardResponse) SetData(data []byte)         { r.pb.Data = data }
 
+func (r *MapShardResponse) SetType(t ResponseType) {
+	pt := internal.MapShardResponse_ResponseType(t)
+	r.pb.Type = &pt
+}
+
+func (r *MapShardResponse) SetLastChunk(last bool) { r.pb.LastChunk = &last }
+
+// Compression reports which codec Data was encoded with.
+func (r *MapShardResponse) Compression() Compression {
+	return Compression(r.pb.GetCompression())
+}
+
+// SetCompressedData snappy-encodes data and stores it, recording
+// CompressionSnappy so a reader knows to reverse it before use.
+func (r *MapShardResponse) SetCompressedData(data []byte) {
+	cc := internal.MapShardResponse_COMPRESSION_SNAPPY
+	r.pb.Compression = &cc
+	r.pb.Data = snappy.Encode(nil, data)
+}
+
+// DecompressedData returns Data, reversing the codec recorded by
+// Compression if one was applied.
+func (r *MapShardResponse) DecompressedData() ([]byte, error) {
+	if r.Compression() != CompressionSnappy {
+		return r.pb.GetData(), nil
+	}
+	return snappy.Decode(nil, r.pb.GetData())
+}
+
 // MarshalBinary encodes the object to a binary format.
 func (r *MapShardResponse) MarshalBinary() ([]byte, error) {
 	return proto.Marshal(&r.pb)
@@ -73,6 +128,22 @@ func (r *MapShardResponse) UnmarshalBinary(buf []byte) error {
 	return nil
 }
 
+// ConsistencyLevel specifies how many replicas must acknowledge a write
+// before the coordinator considers it successful.
+type ConsistencyLevel int
+
+const (
+	// ConsistencyLevelAny allows a hinted-handoff write to satisfy the
+	// request, even if no replica has stored the data durably yet.
+	ConsistencyLevelAny ConsistencyLevel = iota
+	// ConsistencyLevelOne requires only one replica to confirm a write.
+	ConsistencyLevelOne
+	// ConsistencyLevelQuorum requires a majority of replicas to confirm.
+	ConsistencyLevelQuorum
+	// ConsistencyLevelAll requires all replicas to confirm a write.
+	ConsistencyLevelAll
+)
+
 // WritePointsRequest represents a request to write point data to the cluster
 type WritePointsRequest struct {
 	Database         string
@@ -101,6 +172,47 @@ type WriteShardResponse struct {
 func (w *WriteShardRequest) SetShardID(id uint64) { w.pb.ShardID = &id }
 func (w *WriteShardRequest) ShardID() uint64      { return w.pb.GetShardID() }
 
+// SetDatabase and SetRetentionPolicy record the origin database and
+// retention policy of the points being forwarded. In a fully-replicated
+// cluster the receiving node's shard ID may not match the sender's (shards
+// are created independently on each node), so the receiver resolves the
+// target shard by (Database, RetentionPolicy, ShardID) rather than ShardID
+// alone; without these, fully-replicated writes are silently dropped
+// whenever the IDs happen to diverge.
+func (w *WriteShardRequest) SetDatabase(db string)        { w.pb.Database = &db }
+func (w *WriteShardRequest) SetRetentionPolicy(rp string) { w.pb.RetentionPolicy = &rp }
+
+func (w *WriteShardRequest) Database() string        { return w.pb.GetDatabase() }
+func (w *WriteShardRequest) RetentionPolicy() string { return w.pb.GetRetentionPolicy() }
+
+// ConsistencyLevel and RequestID travel with the request so a replica can
+// make local hinted-handoff decisions and so its response can be matched
+// back up with the write it answers, without the coordinator having to
+// track pending writes by shard ID alone.
+func (w *WriteShardRequest) ConsistencyLevel() ConsistencyLevel {
+	return ConsistencyLevel(w.pb.GetConsistencyLevel())
+}
+func (w *WriteShardRequest) RequestID() uint64 { return w.pb.GetRequestID() }
+
+func (w *WriteShardRequest) SetConsistencyLevel(l ConsistencyLevel) {
+	w.pb.ConsistencyLevel = proto.Uint32(uint32(l))
+}
+func (w *WriteShardRequest) SetRequestID(id uint64) { w.pb.RequestID = &id }
+
+// Compression reports the codec recorded by SetCompression (or carried in
+// a decoded request), which is the codec MarshalBinaryCompressed applies.
+// A receiver that decompressed the frame itself (rather than relying on a
+// pre-negotiated connection-level codec) can use it to confirm what it
+// just undid.
+func (w *WriteShardRequest) Compression() Compression {
+	return Compression(w.pb.GetCompression())
+}
+
+func (w *WriteShardRequest) SetCompression(c Compression) {
+	cc := internal.WriteShardRequest_Compression(c)
+	w.pb.Compression = &cc
+}
+
 func (w *WriteShardRequest) Points() []tsdb.Point { return w.unmarshalPoints() }
 
 func (w *WriteShardRequest) AddPoint(name string, value interface{}, timestamp time.Time, tags map[string]string) {
@@ -118,10 +230,68 @@ func (w *WriteShardRequest) MarshalBinary() ([]byte, error) {
 	return proto.Marshal(&w.pb)
 }
 
+// MarshalBinaryCompressed encodes the object exactly as MarshalBinary
+// does, then, if SetCompression(CompressionSnappy) was called, runs the
+// result through snappy before returning it. Point batches are highly
+// compressible (repeated measurement names, tag keys and values), so this
+// trades a little CPU for meaningfully smaller frames on the wire.
+// UnmarshalBinaryCompressed is the matching decode step.
+func (w *WriteShardRequest) MarshalBinaryCompressed() ([]byte, error) {
+	b, err := w.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	if w.Compression() != CompressionSnappy {
+		return b, nil
+	}
+	return snappy.Encode(nil, b), nil
+}
+
+// UnmarshalBinaryCompressed undoes MarshalBinaryCompressed: it snappy-
+// decodes buf before handing it to UnmarshalBinary. Callers that don't
+// know ahead of time whether a frame was compressed should instead rely
+// on the codec negotiated for the connection it arrived on (see
+// negotiateCompression) and call UnmarshalBinary or this method
+// accordingly, rather than guessing from the bytes themselves.
+func (w *WriteShardRequest) UnmarshalBinaryCompressed(buf []byte) error {
+	raw, err := snappy.Decode(nil, buf)
+	if err != nil {
+		return err
+	}
+	return w.UnmarshalBinary(raw)
+}
+
+// MarshalToBuffer encodes the object using a hand-written, allocation-free
+// Marshal/Size path instead of proto.Marshal's reflection, growing buf (a
+// buffer obtained from getWriteBuffer, typically) as needed and returning
+// the result. Unlike MarshalBinary, the returned slice aliases buf when buf
+// has enough capacity; otherwise it is a new, larger slice, which callers
+// hand to putWriteBuffer in buf's place. Either way, callers must not hold
+// onto it past that putWriteBuffer.
+//
+// This only avoids allocating during the final encode step. AddPoints
+// still allocates one *internal.Point, one *internal.Field per field, and
+// one boxed scalar per field, because that's the tree MarshalToBuffer
+// walks; building it remains the larger cost for big batches. See
+// BenchmarkWriteShardRequestAddPoints.
+func (w *WriteShardRequest) MarshalToBuffer(buf []byte) ([]byte, error) {
+	size := w.pb.Size()
+	if cap(buf) < size {
+		buf = make([]byte, size)
+	} else {
+		buf = buf[:size]
+	}
+	n, err := w.pb.MarshalTo(buf)
+	if err != nil {
+		return nil, err
+	}
+	return buf[:n], nil
+}
+
 func (w *WriteShardRequest) marshalPoints(points []tsdb.Point) []*internal.Point {
 	pts := make([]*internal.Point, len(points))
 	for i, p := range points {
-		fields := []*internal.Field{}
+		fields := make([]*internal.Field, 0, len(p.Fields()))
 		for k, v := range p.Fields() {
 			name := k
 			f := &internal.Field{
@@ -146,7 +316,7 @@ func (w *WriteShardRequest) marshalPoints(points []tsdb.Point) []*internal.Point
 			fields = append(fields, f)
 		}
 
-		tags := []*internal.Tag{}
+		tags := make([]*internal.Tag, 0, len(p.Tags()))
 		for k, v := range p.Tags() {
 			key := k
 			value := v
@@ -215,6 +385,44 @@ func (w *WriteShardResponse) SetMessage(message string) { w.pb.Message = &messag
 func (w *WriteShardResponse) Code() int       { return int(w.pb.GetCode()) }
 func (w *WriteShardResponse) Message() string { return w.pb.GetMessage() }
 
+// PointsWritten, PointsDropped, and PointErrors report the real, per-point
+// outcome of a shard write, so the coordinator can report ErrPartialWrite
+// (some points landed, some didn't) for a replica whose response Code
+// alone says success. ErrWriteFailed is decided separately, by how many
+// replicas answered without error.
+func (w *WriteShardResponse) PointsWritten() uint64 { return w.pb.GetPointsWritten() }
+func (w *WriteShardResponse) PointsDropped() uint64 { return w.pb.GetPointsDropped() }
+
+func (w *WriteShardResponse) SetPointsWritten(n uint64) { w.pb.PointsWritten = &n }
+func (w *WriteShardResponse) SetPointsDropped(n uint64) { w.pb.PointsDropped = &n }
+
+// PointErrors reports the index (into the originating WriteShardRequest's
+// Points) and reason for each point that failed to write.
+func (w *WriteShardResponse) PointErrors() []PointError {
+	pe := w.pb.GetPointErrors()
+	errs := make([]PointError, len(pe))
+	for i, e := range pe {
+		errs[i] = PointError{Index: e.GetIndex(), Reason: e.GetReason()}
+	}
+	return errs
+}
+
+// AddPointError records that the point at index failed to write for the
+// given reason.
+func (w *WriteShardResponse) AddPointError(index uint32, reason string) {
+	w.pb.PointErrors = append(w.pb.PointErrors, &internal.PointError{
+		Index:  &index,
+		Reason: &reason,
+	})
+}
+
+// PointError identifies a single point, by its index into the originating
+// WriteShardRequest's Points, that failed to write.
+type PointError struct {
+	Index  uint32
+	Reason string
+}
+
 // MarshalBinary encodes the object to a binary format.
 func (w *WriteShardResponse) MarshalBinary() ([]byte, error) {
 	return proto.Marshal(&w.pb)
@@ -0,0 +1,139 @@
+package cluster
+
+import (
+	"testing"
+	"time"
+
+	"github.com/influxdb/influxdb/tsdb"
+)
+
+func benchPoints(n int) []tsdb.Point {
+	pts := make([]tsdb.Point, n)
+	for i := range pts {
+		pts[i] = tsdb.NewPoint(
+			"cpu",
+			map[string]string{"host": "server01", "region": "us-west"},
+			map[string]interface{}{"value": float64(i)},
+			time.Unix(0, int64(i)),
+		)
+	}
+	return pts
+}
+
+func benchmarkWriteShardRequestMarshalBinary(b *testing.B, n int) {
+	points := benchPoints(n)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		req := &WriteShardRequest{}
+		req.SetShardID(1)
+		req.AddPoints(points)
+
+		if _, err := req.MarshalBinary(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkWriteShardRequestMarshalBinary_1k(b *testing.B) {
+	benchmarkWriteShardRequestMarshalBinary(b, 1000)
+}
+func BenchmarkWriteShardRequestMarshalBinary_10k(b *testing.B) {
+	benchmarkWriteShardRequestMarshalBinary(b, 10000)
+}
+func BenchmarkWriteShardRequestMarshalBinary_100k(b *testing.B) {
+	benchmarkWriteShardRequestMarshalBinary(b, 100000)
+}
+
+// benchmarkWriteShardRequestMarshalToBuffer rebuilds req from scratch every
+// iteration (rather than reusing one built before b.ResetTimer) so the
+// measured region includes AddPoints/marshalPoints, not just the
+// MarshalToBuffer encode step - otherwise the benchmark would only ever
+// show the cost of the part of the path that's actually allocation-free.
+func benchmarkWriteShardRequestMarshalToBuffer(b *testing.B, n int) {
+	points := benchPoints(n)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		req := &WriteShardRequest{}
+		req.SetShardID(1)
+		req.AddPoints(points)
+
+		buf := getWriteBuffer()
+		out, err := req.MarshalToBuffer(buf)
+		if err != nil {
+			b.Fatal(err)
+		}
+		putWriteBuffer(out)
+	}
+}
+
+// benchmarkWriteShardRequestAddPoints isolates AddPoints/marshalPoints -
+// the boxed internal.Point/internal.Field tree construction - from any
+// encode step, so it's clear how much of the cost above comes from
+// building that tree versus actually serializing it.
+func benchmarkWriteShardRequestAddPoints(b *testing.B, n int) {
+	points := benchPoints(n)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		req := &WriteShardRequest{}
+		req.SetShardID(1)
+		req.AddPoints(points)
+	}
+}
+
+func BenchmarkWriteShardRequestAddPoints_1k(b *testing.B) {
+	benchmarkWriteShardRequestAddPoints(b, 1000)
+}
+func BenchmarkWriteShardRequestAddPoints_10k(b *testing.B) {
+	benchmarkWriteShardRequestAddPoints(b, 10000)
+}
+func BenchmarkWriteShardRequestAddPoints_100k(b *testing.B) {
+	benchmarkWriteShardRequestAddPoints(b, 100000)
+}
+
+func BenchmarkWriteShardRequestMarshalToBuffer_1k(b *testing.B) {
+	benchmarkWriteShardRequestMarshalToBuffer(b, 1000)
+}
+func BenchmarkWriteShardRequestMarshalToBuffer_10k(b *testing.B) {
+	benchmarkWriteShardRequestMarshalToBuffer(b, 10000)
+}
+func BenchmarkWriteShardRequestMarshalToBuffer_100k(b *testing.B) {
+	benchmarkWriteShardRequestMarshalToBuffer(b, 100000)
+}
+
+// BenchmarkWriteShardRequestCompression reports, via b.ReportMetric, the
+// wire-size reduction snappy gives a representative 5k-point batch of
+// repeated measurement/tag names - the case the compression knob exists
+// for.
+func BenchmarkWriteShardRequestCompression(b *testing.B) {
+	req := &WriteShardRequest{}
+	req.SetShardID(1)
+	req.AddPoints(benchPoints(5000))
+
+	raw, err := req.MarshalBinary()
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	req.SetCompression(CompressionSnappy)
+	compressed, err := req.MarshalBinaryCompressed()
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportMetric(float64(len(raw)), "raw-bytes")
+	b.ReportMetric(float64(len(compressed)), "snappy-bytes")
+	b.ReportMetric(float64(len(raw))/float64(len(compressed)), "x-ratio")
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := req.MarshalBinaryCompressed(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package cluster
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/influxdb/influxdb/cluster/internal"
+)
+
+// ResponseType distinguishes the frames of a chunked MapShardResponse
+// stream written by writeMapShardResponse/read by readMapShardResponse.
+type ResponseType int
+
+const (
+	// ResponseHeader is always the first frame: Code, Message, TagSets and
+	// Fields, with no Data.
+	ResponseHeader ResponseType = ResponseType(internal.MapShardResponse_HEADER)
+	// ResponseChunk carries one ChunkSize-bounded slice of mapper output.
+	ResponseChunk ResponseType = ResponseType(internal.MapShardResponse_CHUNK)
+	// ResponseEOF terminates a successful stream; it carries no Data.
+	ResponseEOF ResponseType = ResponseType(internal.MapShardResponse_EOF)
+	// ResponseError terminates a stream that failed partway through.
+	ResponseError ResponseType = ResponseType(internal.MapShardResponse_ERROR)
+)
+
+// MaxMessageSize bounds a single TLV frame on a MapShardResponse stream, so
+// a mapper that runs away (or a corrupt length prefix) can't make the
+// coordinator allocate an unbounded buffer.
+const MaxMessageSize = 16 * 1024 * 1024
+
+// writeMapShardResponse writes resp to w as a single length-prefixed (TLV)
+// frame: a uvarint byte length followed by the marshaled protobuf. Chunked
+// responses are sent as a sequence of these frames on the same connection.
+func writeMapShardResponse(w io.Writer, resp *MapShardResponse) error {
+	b, err := resp.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	if len(b) > MaxMessageSize {
+		return fmt.Errorf("cluster: MapShardResponse frame of %d bytes exceeds MaxMessageSize (%d)", len(b), MaxMessageSize)
+	}
+
+	var lenBuf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(lenBuf[:], uint64(len(b)))
+	if _, err := w.Write(lenBuf[:n]); err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+// readMapShardResponse reads a single frame written by writeMapShardResponse.
+func readMapShardResponse(r io.Reader) (*MapShardResponse, error) {
+	size, err := binary.ReadUvarint(byteReader{r})
+	if err != nil {
+		return nil, err
+	}
+	if size > MaxMessageSize {
+		return nil, fmt.Errorf("cluster: MapShardResponse frame of %d bytes exceeds MaxMessageSize (%d)", size, MaxMessageSize)
+	}
+
+	buf := make([]byte, size)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, err
+	}
+
+	resp := &MapShardResponse{}
+	if err := resp.UnmarshalBinary(buf); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// writeMapShardResponseChunked writes header as the leading ResponseHeader
+// frame, then splits data into ChunkSize-bounded ResponseChunk frames, and
+// finally writes a ResponseEOF frame. This is the server-side counterpart
+// to MapShardResponseStream. It takes the mapper's whole output as data,
+// so that output is held in memory in full before the first chunk is
+// written; only the wire framing is chunked.
+// When codec is CompressionSnappy, each chunk's Data is snappy-encoded via
+// SetCompressedData before it goes out, and MapShardResponseStream.Next
+// reverses it on the read side.
+func writeMapShardResponseChunked(w io.Writer, header *MapShardResponse, data []byte, chunkSize int, codec Compression) error {
+	if chunkSize <= 0 {
+		chunkSize = MaxMessageSize
+	}
+
+	header.SetType(ResponseHeader)
+	if err := writeMapShardResponse(w, header); err != nil {
+		return err
+	}
+
+	for len(data) > 0 {
+		n := chunkSize
+		if n > len(data) {
+			n = len(data)
+		}
+		chunk := &MapShardResponse{}
+		chunk.SetType(ResponseChunk)
+		if codec == CompressionSnappy {
+			chunk.SetCompressedData(data[:n])
+		} else {
+			chunk.SetData(data[:n])
+		}
+		chunk.SetLastChunk(n == len(data))
+		if err := writeMapShardResponse(w, chunk); err != nil {
+			return err
+		}
+		data = data[n:]
+	}
+
+	eof := &MapShardResponse{}
+	eof.SetType(ResponseEOF)
+	return writeMapShardResponse(w, eof)
+}
+
+// byteReader adapts an io.Reader to io.ByteReader one byte at a time, which
+// is all binary.ReadUvarint needs and all a bare io.Reader guarantees.
+type byteReader struct {
+	io.Reader
+}
+
+func (b byteReader) ReadByte() (byte, error) {
+	var buf [1]byte
+	if _, err := io.ReadFull(b.Reader, buf[:]); err != nil {
+		return 0, err
+	}
+	return buf[0], nil
+}
+
+// MapShardResponseStream presents a chunked MapShardResponse wire stream as
+// an iterator of Data payloads, hiding the Header/Chunk/EOF/Error framing
+// from callers that just want the rows.
+type MapShardResponseStream struct {
+	r       io.Reader
+	header  *MapShardResponse
+	err     error
+	done    bool
+	pending []byte
+}
+
+// NewMapShardResponseStream reads the Header frame from r and returns a
+// stream ready to yield the Chunk frames that follow.
+func NewMapShardResponseStream(r io.Reader) (*MapShardResponseStream, error) {
+	header, err := readMapShardResponse(r)
+	if err != nil {
+		return nil, err
+	}
+	if header.Type() != ResponseHeader {
+		return nil, fmt.Errorf("cluster: expected a MapShardResponse header frame, got %v", header.Type())
+	}
+	return &MapShardResponseStream{r: r, header: header}, nil
+}
+
+// Header returns the Code/Message/TagSets/Fields carried by the stream's
+// leading frame.
+func (s *MapShardResponseStream) Header() *MapShardResponse { return s.header }
+
+// Next returns the next chunk's Data, io.EOF once the stream's ResponseEOF
+// frame has been consumed, or the error carried by a ResponseError frame.
+func (s *MapShardResponseStream) Next() ([]byte, error) {
+	if s.done {
+		return nil, io.EOF
+	}
+	if s.err != nil {
+		return nil, s.err
+	}
+
+	resp, err := readMapShardResponse(s.r)
+	if err != nil {
+		s.err = err
+		return nil, err
+	}
+
+	switch resp.Type() {
+	case ResponseChunk:
+		// LastChunk is informational only (it tells a caller reading chunk
+		// boundaries that no more Data will follow) — writeMapShardResponseChunked
+		// always writes a trailing ResponseEOF frame after the last chunk, and
+		// that frame must still be read off the wire or it strands a frame on
+		// a reused/muxed connection.
+		data, err := resp.DecompressedData()
+		if err != nil {
+			s.err = err
+			return nil, err
+		}
+		return data, nil
+	case ResponseEOF:
+		s.done = true
+		return nil, io.EOF
+	case ResponseError:
+		s.err = fmt.Errorf("cluster: remote mapper error: %s", resp.Message())
+		return nil, s.err
+	default:
+		s.err = fmt.Errorf("cluster: unexpected MapShardResponse frame type %v", resp.Type())
+		return nil, s.err
+	}
+}
+
+// Read implements io.Reader over the concatenated Data payloads of every
+// chunk, so callers that would rather stream bytes than call Next in a
+// loop can use the stream as a plain io.Reader.
+func (s *MapShardResponseStream) Read(p []byte) (int, error) {
+	for len(s.pending) == 0 {
+		chunk, err := s.Next()
+		if err != nil {
+			return 0, err
+		}
+		s.pending = chunk
+	}
+	n := copy(p, s.pending)
+	s.pending = s.pending[n:]
+	return n, nil
+}
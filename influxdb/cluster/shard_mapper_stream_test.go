@@ -0,0 +1,130 @@
+package cluster
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+func TestMapShardResponseStreamReadsAllChunksThenEOF(t *testing.T) {
+	var buf bytes.Buffer
+
+	header := &MapShardResponse{}
+	header.SetCode(0)
+	if err := writeMapShardResponseChunked(&buf, header, []byte("hello world"), 4, CompressionNone); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := NewMapShardResponseStream(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []byte
+	for {
+		chunk, err := s.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, chunk...)
+	}
+
+	if string(got) != "hello world" {
+		t.Errorf("got %q, want %q", got, "hello world")
+	}
+
+	// The trailing ResponseEOF frame must have been consumed by the loop
+	// above, not stranded on the connection for a reused/muxed reader.
+	if buf.Len() != 0 {
+		t.Errorf("%d bytes left unread on the stream after EOF", buf.Len())
+	}
+
+	// Calling Next again after EOF must keep returning io.EOF rather than
+	// trying to read past the end of the stream.
+	if _, err := s.Next(); err != io.EOF {
+		t.Errorf("Next() after EOF = %v, want io.EOF", err)
+	}
+}
+
+func TestMapShardResponseStreamError(t *testing.T) {
+	var buf bytes.Buffer
+
+	header := &MapShardResponse{}
+	header.SetType(ResponseHeader)
+	if err := writeMapShardResponse(&buf, header); err != nil {
+		t.Fatal(err)
+	}
+
+	errResp := &MapShardResponse{}
+	errResp.SetType(ResponseError)
+	errResp.SetMessage("boom")
+	if err := writeMapShardResponse(&buf, errResp); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := NewMapShardResponseStream(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.Next(); err == nil {
+		t.Fatal("expected an error from Next(), got nil")
+	}
+}
+
+func TestMapShardResponseStreamRead(t *testing.T) {
+	var buf bytes.Buffer
+
+	header := &MapShardResponse{}
+	if err := writeMapShardResponseChunked(&buf, header, []byte("abcdefgh"), 3, CompressionNone); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := NewMapShardResponseStream(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := ioutil.ReadAll(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "abcdefgh" {
+		t.Errorf("got %q, want %q", got, "abcdefgh")
+	}
+}
+
+func TestMapShardResponseStreamReadsCompressedChunks(t *testing.T) {
+	var buf bytes.Buffer
+
+	header := &MapShardResponse{}
+	header.SetCode(0)
+	if err := writeMapShardResponseChunked(&buf, header, []byte("hello world"), 4, CompressionSnappy); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := NewMapShardResponseStream(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []byte
+	for {
+		chunk, err := s.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, chunk...)
+	}
+
+	if string(got) != "hello world" {
+		t.Errorf("got %q, want %q", got, "hello world")
+	}
+}
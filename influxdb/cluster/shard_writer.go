@@ -0,0 +1,137 @@
+package cluster
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/influxdb/influxdb/tsdb"
+)
+
+// negotiationTimeout bounds how long WriteShard waits for a peer's
+// compression capability byte before falling back to CompressionNone, so
+// a node that predates negotiateCompression entirely (and so never
+// writes one) doesn't hang the write forever.
+const negotiationTimeout = 5 * time.Second
+
+// deadliner is implemented by net.Conn; a Dialer's connection is checked
+// against it so negotiateCompression can be bounded by negotiationTimeout
+// when the underlying transport supports deadlines.
+type deadliner interface {
+	SetDeadline(t time.Time) error
+}
+
+// Dialer opens a connection to the cluster service on ownerID, already
+// routed past any TCP mux in front of it and ready for negotiateCompression
+// to run as the very first thing on the wire.
+type Dialer func(ownerID uint64) (io.ReadWriteCloser, error)
+
+// NetShardWriter is the network ShardWriter: for every WriteShard call it
+// dials ownerID, negotiates a compression codec with negotiateCompression
+// using Config's preference, and sends the batch as a single
+// WriteShardRequest frame.
+type NetShardWriter struct {
+	Dial   Dialer
+	Config Config
+}
+
+// NewNetShardWriter returns a NetShardWriter that dials peers with dial and
+// prefers the codec cfg.compression() reports.
+func NewNetShardWriter(dial Dialer, cfg Config) *NetShardWriter {
+	return &NetShardWriter{Dial: dial, Config: cfg}
+}
+
+// WriteShard implements ShardWriter.
+func (s *NetShardWriter) WriteShard(shardID, ownerID uint64, database, retentionPolicy string, requestID uint64, level ConsistencyLevel, points []tsdb.Point) (*WriteShardResponse, error) {
+	conn, err := s.Dial(ownerID)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	dc, hasDeadline := conn.(deadliner)
+	if hasDeadline {
+		dc.SetDeadline(time.Now().Add(negotiationTimeout))
+	}
+
+	codec, err := negotiateCompression(conn, s.Config.compression())
+	if hasDeadline {
+		dc.SetDeadline(time.Time{})
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	req := &WriteShardRequest{}
+	req.SetShardID(shardID)
+	req.SetDatabase(database)
+	req.SetRetentionPolicy(retentionPolicy)
+	req.SetRequestID(requestID)
+	req.SetConsistencyLevel(level)
+	req.AddPoints(points)
+	req.SetCompression(codec)
+
+	buf := getWriteBuffer()
+	b, err := req.MarshalToBuffer(buf)
+	if err != nil {
+		putWriteBuffer(buf)
+		return nil, err
+	}
+	// b is buf, or the larger buffer MarshalToBuffer grew it into; pool
+	// that one so the next write of a similar batch can reuse it.
+	defer putWriteBuffer(b)
+	if codec == CompressionSnappy {
+		b = snappy.Encode(nil, b)
+	}
+	if err := writeShardFrame(conn, b); err != nil {
+		return nil, err
+	}
+
+	respBuf, err := readShardFrame(conn)
+	if err != nil {
+		return nil, err
+	}
+	resp := &WriteShardResponse{}
+	if err := resp.UnmarshalBinary(respBuf); err != nil {
+		return nil, err
+	}
+	if resp.Code() != 0 {
+		return resp, fmt.Errorf("cluster: WriteShard to node %d failed: %s", ownerID, resp.Message())
+	}
+	return resp, nil
+}
+
+// writeShardFrame writes b to w as a single length-prefixed (TLV) frame,
+// the same framing writeMapShardResponse uses, so a WriteShardRequest/
+// WriteShardResponse pair can share a connection with chunked
+// MapShardResponse streams.
+func writeShardFrame(w io.Writer, b []byte) error {
+	if len(b) > MaxMessageSize {
+		return fmt.Errorf("cluster: WriteShard frame of %d bytes exceeds MaxMessageSize (%d)", len(b), MaxMessageSize)
+	}
+	var lenBuf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(lenBuf[:], uint64(len(b)))
+	if _, err := w.Write(lenBuf[:n]); err != nil {
+		return err
+	}
+	_, err := w.Write(b)
+	return err
+}
+
+// readShardFrame reads a single frame written by writeShardFrame.
+func readShardFrame(r io.Reader) ([]byte, error) {
+	size, err := binary.ReadUvarint(byteReader{r})
+	if err != nil {
+		return nil, err
+	}
+	if size > MaxMessageSize {
+		return nil, fmt.Errorf("cluster: WriteShard frame of %d bytes exceeds MaxMessageSize (%d)", size, MaxMessageSize)
+	}
+	buf := make([]byte, size)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
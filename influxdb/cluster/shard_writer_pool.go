@@ -0,0 +1,22 @@
+package cluster
+
+import "sync"
+
+// writeBufferPool holds the []byte buffers used by
+// WriteShardRequest.MarshalToBuffer, so repeated writes to the same shard
+// don't each pay for a fresh allocation sized to the batch.
+var writeBufferPool = sync.Pool{
+	New: func() interface{} { return make([]byte, 0, 4096) },
+}
+
+// getWriteBuffer returns a pooled buffer truncated to length 0 and ready
+// to be grown with append.
+func getWriteBuffer() []byte {
+	return writeBufferPool.Get().([]byte)[:0]
+}
+
+// putWriteBuffer returns buf to the pool for reuse. Callers must not use
+// buf again after calling this.
+func putWriteBuffer(buf []byte) {
+	writeBufferPool.Put(buf)
+}
@@ -0,0 +1,140 @@
+package cluster
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/influxdb/influxdb/tsdb"
+)
+
+// dialListener returns a Dialer that always connects to ln, ignoring
+// ownerID - enough for a test with a single simulated peer.
+func dialListener(ln net.Listener) Dialer {
+	return func(ownerID uint64) (io.ReadWriteCloser, error) {
+		return net.Dial(ln.Addr().Network(), ln.Addr().String())
+	}
+}
+
+func TestNetShardWriterWriteShard(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	serverErr := make(chan error, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			serverErr <- err
+			return
+		}
+		defer conn.Close()
+
+		codec, err := negotiateCompression(conn, CompressionNone)
+		if err != nil {
+			serverErr <- err
+			return
+		}
+
+		buf, err := readShardFrame(conn)
+		if err != nil {
+			serverErr <- err
+			return
+		}
+
+		req := &WriteShardRequest{}
+		if codec == CompressionSnappy {
+			err = req.UnmarshalBinaryCompressed(buf)
+		} else {
+			err = req.UnmarshalBinary(buf)
+		}
+		if err != nil {
+			serverErr <- err
+			return
+		}
+
+		if req.ShardID() != 1 {
+			serverErr <- fmt.Errorf("ShardID() = %d, want 1", req.ShardID())
+			return
+		}
+		if req.Database() != "mydb" || req.RetentionPolicy() != "autogen" {
+			serverErr <- fmt.Errorf("got (db, rp) = (%q, %q), want (%q, %q)", req.Database(), req.RetentionPolicy(), "mydb", "autogen")
+			return
+		}
+		if len(req.Points()) != 3 {
+			serverErr <- fmt.Errorf("len(Points()) = %d, want 3", len(req.Points()))
+			return
+		}
+
+		resp := &WriteShardResponse{}
+		resp.SetCode(0)
+		respBuf, err := resp.MarshalBinary()
+		if err != nil {
+			serverErr <- err
+			return
+		}
+		serverErr <- writeShardFrame(conn, respBuf)
+	}()
+
+	points := make([]tsdb.Point, 3)
+	for i := range points {
+		points[i] = tsdb.NewPoint("cpu", nil, map[string]interface{}{"value": i}, time.Unix(0, int64(i)))
+	}
+
+	w := NewNetShardWriter(dialListener(ln), Config{Compression: "snappy"})
+	if _, err := w.WriteShard(1, 2, "mydb", "autogen", 42, ConsistencyLevelOne, points); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-serverErr; err != nil {
+		t.Fatalf("server side: %v", err)
+	}
+}
+
+func TestNetShardWriterWriteShardError(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	serverErr := make(chan error, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			serverErr <- err
+			return
+		}
+		defer conn.Close()
+
+		if _, err := negotiateCompression(conn, CompressionNone); err != nil {
+			serverErr <- err
+			return
+		}
+		if _, err := readShardFrame(conn); err != nil {
+			serverErr <- err
+			return
+		}
+
+		resp := &WriteShardResponse{}
+		resp.SetCode(1)
+		resp.SetMessage("shard not found")
+		respBuf, err := resp.MarshalBinary()
+		if err != nil {
+			serverErr <- err
+			return
+		}
+		serverErr <- writeShardFrame(conn, respBuf)
+	}()
+
+	w := NewNetShardWriter(dialListener(ln), Config{Compression: "none"})
+	if _, err := w.WriteShard(1, 2, "mydb", "autogen", 42, ConsistencyLevelOne, nil); err == nil {
+		t.Fatal("expected an error from a non-zero response code, got nil")
+	}
+	if serr := <-serverErr; serr != nil {
+		t.Fatalf("server side: %v", serr)
+	}
+}